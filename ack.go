@@ -0,0 +1,184 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Header version in Msg.Z16. The original header is all zero; whereas, the
+// sequenced header has a request sequence number in Msg.Z32 that the driver
+// returns in its ack or nak.
+const (
+	XETH_MSG_HEADER_V1 = iota
+	XETH_MSG_HEADER_SEQ
+)
+
+const SizeofMsgAck = 0x18
+
+// Driver reply to a sequenced request; Errno is zero in ack and non-zero in
+// nak messages.
+type MsgAck struct {
+	Z64   uint64
+	Z32   uint32
+	Z16   uint16
+	Z8    uint8
+	Kind  uint8
+	Errno int32
+	Pad   [4]uint8
+}
+
+func ToMsgAck(buf []byte) *MsgAck {
+	return (*MsgAck)(unsafe.Pointer(&buf[0]))
+}
+
+// Returns the sequence number of a sequenced header.
+func (msg *Msg) Seq() (uint32, bool) {
+	return msg.Z32, msg.Z16 == XETH_MSG_HEADER_SEQ
+}
+
+// Mark the header as sequenced with the given request number.
+func (msg *Msg) SetSeq(seq uint32) {
+	msg.Z16 = XETH_MSG_HEADER_SEQ
+	msg.Z32 = seq
+}
+
+// NakError is returned by Do with the driver's nak of a request.
+type NakError struct {
+	Kind  Kind
+	Seq   uint32
+	Errno syscall.Errno
+}
+
+func (err *NakError) Error() string {
+	return fmt.Sprint(err.Kind, " request ", err.Seq, ": ", err.Errno)
+}
+
+func (err *NakError) Unwrap() error { return err.Errno }
+
+type ackWaiter struct {
+	kind  Kind
+	reply chan error
+}
+
+var acks struct {
+	sync.Mutex
+	seq     uint32
+	waiting map[uint32]ackWaiter
+}
+
+// Send the request in buf with a sequenced header then wait for the driver's
+// ack, returning nil, or nak, returning a *NakError, until the context is
+// done. Do replaces the header's zero Z16 and Z32 fields; so, it won't send to
+// drivers that haven't negotiated acks.
+func Do(ctx context.Context, buf []byte) error {
+	if !Supports(XETH_MSG_KIND_ACK) {
+		return &UnsupportedError{XETH_MSG_KIND_ACK}
+	}
+	msg := ToMsg(buf)
+	reply := make(chan error, 1)
+	acks.Lock()
+	if acks.waiting == nil {
+		acks.waiting = make(map[uint32]ackWaiter)
+	}
+	acks.seq++
+	if acks.seq == 0 {
+		acks.seq++
+	}
+	seq := acks.seq
+	acks.waiting[seq] = ackWaiter{Kind(msg.Kind), reply}
+	acks.Unlock()
+	defer func() {
+		acks.Lock()
+		delete(acks.waiting, seq)
+		acks.Unlock()
+	}()
+	msg.SetSeq(seq)
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		if timeout = time.Until(deadline); timeout <= 0 {
+			return context.DeadlineExceeded
+		}
+	}
+	if err := tx(buf, timeout); err != nil {
+		return err
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Time that the Set functions wait for the driver's ack
+var AckTimeout = time.Second
+
+// Send the request with Do if the driver acks, returning true once acked;
+// otherwise queue it with Tx and return false so that the caller leaves
+// caching to the driver's echo.
+func request(buf []byte) (bool, error) {
+	if !Supports(XETH_MSG_KIND_ACK) {
+		return false, Tx(buf)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), AckTimeout)
+	defer cancel()
+	if err := Do(ctx, buf); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Called by gorx with each ack or nak.
+func acked(buf []byte) {
+	msg := ToMsgAck(buf)
+	seq, _ := ToMsg(buf).Seq()
+	acks.Lock()
+	defer acks.Unlock()
+	waiter, found := acks.waiting[seq]
+	if !found {
+		return
+	}
+	var err error
+	if msg.Errno != 0 {
+		err = &NakError{waiter.kind, seq, syscall.Errno(msg.Errno)}
+	}
+	waiter.reply <- err
+	delete(acks.waiting, seq)
+}
+
+// Called by gorx on exit to fail requests still waiting.
+func unacked(err error) {
+	acks.Lock()
+	defer acks.Unlock()
+	for seq, waiter := range acks.waiting {
+		waiter.reply <- err
+		delete(acks.waiting, seq)
+	}
+}
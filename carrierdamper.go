@@ -0,0 +1,298 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// CarrierDamper sends the carrier state of each ifindex only once it has
+// held for UpHold or DownHold and, with exponential flap dampening, holds
+// the carrier off while the accumulated flap penalty suppresses the link.
+// Use its Carrier method in place of the package Carrier function.
+//
+// Sends are serialized with the damper locked, so Send and OnError mustn't
+// call its methods.
+type CarrierDamper struct {
+	// Time that carrier on or off must hold before it's sent
+	UpHold, DownHold time.Duration
+	// Penalty added by each flap, default 1000
+	Penalty float64
+	// Suppress the link once its penalty reaches Suppress, default 2000,
+	// then reuse after it decays below Reuse, default 1000.
+	Suppress, Reuse float64
+	// Maximum penalty, default 16 times Reuse
+	MaxPenalty float64
+	// Time for penalty to decay by half, default 5s
+	HalfLife time.Duration
+	// If not nil, called instead of Carrier to send settled state
+	Send func(ifindex int32, flag CarrierFlag) error
+	// If not nil, called with each error of a deferred Send
+	OnError func(error)
+	// Time to retry a failed send, default 1s
+	Retry time.Duration
+
+	mutex sync.Mutex
+	links map[int32]*carrierLink
+	// time.Now and time.AfterFunc unless replaced by tests
+	now       func() time.Time
+	afterFunc func(time.Duration, func()) carrierTimer
+}
+
+type CarrierState struct {
+	// Latest carrier reported by the caller and the time it changed
+	Reported CarrierFlag
+	Since    time.Time
+	// Last carrier sent to the driver, if Synced
+	Sent   CarrierFlag
+	Synced bool
+	// Number of on to off transitions
+	Flaps uint64
+	// Penalty as of Updated
+	Penalty    float64
+	Updated    time.Time
+	Suppressed bool
+}
+
+type carrierLink struct {
+	CarrierState
+	timer carrierTimer
+}
+
+type carrierTimer interface {
+	Stop() bool
+}
+
+// Report the carrier state of ifindex to send once settled. If settled
+// without hold, Carrier also returns the result of sending it.
+func (d *CarrierDamper) Carrier(ifindex int32, flag CarrierFlag) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	now := d.time()
+	if d.links == nil {
+		d.links = make(map[int32]*carrierLink)
+	}
+	link, found := d.links[ifindex]
+	if !found {
+		link = &carrierLink{}
+		link.Reported = flag
+		link.Since = now
+		link.Updated = now
+		d.links[ifindex] = link
+	} else if flag != link.Reported {
+		d.decay(link, now)
+		if link.Reported == XETH_CARRIER_ON {
+			link.Flaps++
+			link.Penalty += d.penalty()
+			if max := d.maxPenalty(); link.Penalty > max {
+				link.Penalty = max
+			}
+			if link.Penalty >= d.suppress() {
+				link.Suppressed = true
+			}
+		}
+		link.Reported = flag
+		link.Since = now
+	}
+	if flag, send := d.settle(ifindex, link, now); send {
+		return d.send(ifindex, link, flag)
+	}
+	return nil
+}
+
+// Return a copy of the state of ifindex with penalty decayed to now.
+func (d *CarrierDamper) State(ifindex int32) (CarrierState, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	link, found := d.links[ifindex]
+	if !found {
+		return CarrierState{}, false
+	}
+	d.decay(link, d.time())
+	return link.CarrierState, true
+}
+
+// Stop the timer of ifindex and discard its state.
+func (d *CarrierDamper) Forget(ifindex int32) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if link, found := d.links[ifindex]; found {
+		if link.timer != nil {
+			link.timer.Stop()
+		}
+		delete(d.links, ifindex)
+	}
+}
+
+// Stop all timers and discard all state.
+func (d *CarrierDamper) Stop() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for ifindex, link := range d.links {
+		if link.timer != nil {
+			link.timer.Stop()
+		}
+		delete(d.links, ifindex)
+	}
+}
+
+// Return the carrier to send, if any, otherwise schedule the next settle
+// at the end of the hold time or suppression.
+func (d *CarrierDamper) settle(ifindex int32, link *carrierLink,
+	now time.Time) (CarrierFlag, bool) {
+	if link.timer != nil {
+		link.timer.Stop()
+		link.timer = nil
+	}
+	hold := d.DownHold
+	if link.Reported == XETH_CARRIER_ON {
+		hold = d.UpHold
+	}
+	if settled := link.Since.Add(hold); now.Before(settled) {
+		d.after(ifindex, link, settled.Sub(now))
+		return 0, false
+	}
+	flag := link.Reported
+	if link.Suppressed {
+		d.decay(link, now)
+		if link.Penalty < d.reuse() {
+			link.Suppressed = false
+		} else {
+			flag = XETH_CARRIER_OFF
+			// time to decay to reuse, rounded up to avoid
+			// waking just before
+			halves := math.Log2(link.Penalty / d.reuse())
+			wait := time.Duration(halves*float64(d.halfLife())) +
+				time.Millisecond
+			d.after(ifindex, link, wait)
+		}
+	}
+	if link.Synced && link.Sent == flag {
+		return 0, false
+	}
+	link.Sent = flag
+	link.Synced = true
+	return flag, true
+}
+
+func (d *CarrierDamper) after(ifindex int32, link *carrierLink,
+	wait time.Duration) {
+	settle := func() {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		if d.links[ifindex] != link {
+			return
+		}
+		flag, send := d.settle(ifindex, link, d.time())
+		if send {
+			if err := d.send(ifindex, link, flag); err != nil &&
+				d.OnError != nil {
+				d.OnError(err)
+			}
+		}
+	}
+	if d.afterFunc != nil {
+		link.timer = d.afterFunc(wait, settle)
+	} else {
+		link.timer = time.AfterFunc(wait, settle)
+	}
+}
+
+// Send with the damper locked; on error, resend with the next settle which,
+// if not already scheduled, is after Retry.
+func (d *CarrierDamper) send(ifindex int32, link *carrierLink,
+	flag CarrierFlag) error {
+	var err error
+	if d.Send != nil {
+		err = d.Send(ifindex, flag)
+	} else {
+		err = Carrier(ifindex, uint8(flag))
+	}
+	if err != nil {
+		link.Synced = false
+		if link.timer == nil {
+			d.after(ifindex, link, d.retry())
+		}
+	}
+	return err
+}
+
+func (d *CarrierDamper) time() time.Time {
+	if d.now != nil {
+		return d.now()
+	}
+	return time.Now()
+}
+
+func (d *CarrierDamper) decay(link *carrierLink, now time.Time) {
+	if dt := now.Sub(link.Updated); dt > 0 && link.Penalty > 0 {
+		link.Penalty *= math.Exp2(-float64(dt) /
+			float64(d.halfLife()))
+	}
+	link.Updated = now
+}
+
+func (d *CarrierDamper) penalty() float64 {
+	if d.Penalty == 0 {
+		return 1000
+	}
+	return d.Penalty
+}
+
+func (d *CarrierDamper) suppress() float64 {
+	if d.Suppress == 0 {
+		return 2000
+	}
+	return d.Suppress
+}
+
+func (d *CarrierDamper) reuse() float64 {
+	if d.Reuse == 0 {
+		return 1000
+	}
+	return d.Reuse
+}
+
+func (d *CarrierDamper) maxPenalty() float64 {
+	if d.MaxPenalty == 0 {
+		return 16 * d.reuse()
+	}
+	return d.MaxPenalty
+}
+
+func (d *CarrierDamper) retry() time.Duration {
+	if d.Retry == 0 {
+		return time.Second
+	}
+	return d.Retry
+}
+
+func (d *CarrierDamper) halfLife() time.Duration {
+	if d.HalfLife == 0 {
+		return 5 * time.Second
+	}
+	return d.HalfLife
+}
@@ -0,0 +1,178 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testClock runs the functions of its timers as Advance passes them.
+type testClock struct {
+	now    time.Time
+	timers []*testTimer
+}
+
+type testTimer struct {
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func (c *testClock) AfterFunc(d time.Duration, f func()) carrierTimer {
+	t := &testTimer{at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	end := c.now.Add(d)
+	for {
+		var next *testTimer
+		for _, t := range c.timers {
+			if !t.stopped && !t.at.After(end) &&
+				(next == nil || t.at.Before(next.at)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+		next.stopped = true
+		c.now = next.at
+		next.f()
+	}
+	c.now = end
+}
+
+func (t *testTimer) Stop() bool {
+	stopped := t.stopped
+	t.stopped = true
+	return !stopped
+}
+
+func TestCarrierDamper(t *testing.T) {
+	var sent []CarrierFlag
+	var errs []error
+	fail := errors.New("fail")
+	failing := false
+	clock := &testClock{now: time.Unix(0, 0)}
+	d := &CarrierDamper{
+		UpHold:   20 * time.Millisecond,
+		Suppress: 1500,
+		HalfLife: 100 * time.Millisecond,
+		Retry:    50 * time.Millisecond,
+		Send: func(ifindex int32, flag CarrierFlag) error {
+			if failing {
+				return fail
+			}
+			sent = append(sent, flag)
+			return nil
+		},
+		OnError:   func(err error) { errs = append(errs, err) },
+		now:       clock.Now,
+		afterFunc: clock.AfterFunc,
+	}
+	defer d.Stop()
+	expect := func(want ...CarrierFlag) {
+		t.Helper()
+		if len(sent) != len(want) {
+			t.Fatal("sent", sent, "expected", want)
+		}
+		for i := range want {
+			if sent[i] != want[i] {
+				t.Fatal("sent", sent, "expected", want)
+			}
+		}
+		sent = sent[:0]
+	}
+
+	d.Carrier(3, XETH_CARRIER_ON)
+	clock.Advance(10 * time.Millisecond)
+	expect()
+	clock.Advance(10 * time.Millisecond)
+	expect(XETH_CARRIER_ON)
+
+	// first flap sends off without hold but the following on is held
+	d.Carrier(3, XETH_CARRIER_OFF)
+	expect(XETH_CARRIER_OFF)
+	d.Carrier(3, XETH_CARRIER_ON)
+	d.Carrier(3, XETH_CARRIER_OFF)
+	d.Carrier(3, XETH_CARRIER_ON)
+	clock.Advance(50 * time.Millisecond)
+	expect()
+	state, found := d.State(3)
+	if !found || state.Flaps != 2 || !state.Suppressed {
+		t.Fatal("state", state)
+	}
+
+	// carrier on after penalty decays to reuse, 2000 to 1000 in a half
+	// life
+	clock.Advance(50 * time.Millisecond)
+	expect()
+	clock.Advance(5 * time.Millisecond)
+	expect(XETH_CARRIER_ON)
+	state, _ = d.State(3)
+	if state.Suppressed || state.Sent != XETH_CARRIER_ON ||
+		state.Penalty >= 1000 {
+		t.Fatal("state", state)
+	}
+
+	// retry failed sends
+	failing = true
+	d.Carrier(4, XETH_CARRIER_ON)
+	clock.Advance(20 * time.Millisecond)
+	if len(errs) != 1 || errs[0] != fail {
+		t.Fatal("errors", errs)
+	}
+	if state, _ = d.State(4); state.Synced {
+		t.Fatal("synced after failure")
+	}
+	clock.Advance(50 * time.Millisecond)
+	if len(errs) != 2 {
+		t.Fatal("didn't retry", errs)
+	}
+	failing = false
+	if err := d.Carrier(4, XETH_CARRIER_OFF); err != nil {
+		t.Fatal(err)
+	}
+	expect(XETH_CARRIER_OFF)
+	clock.Advance(time.Second)
+	expect()
+
+	failing = true
+	if err := d.Carrier(4, XETH_CARRIER_ON); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(20 * time.Millisecond)
+	failing = false
+	clock.Advance(50 * time.Millisecond)
+	expect(XETH_CARRIER_ON)
+	if state, _ = d.State(4); !state.Synced {
+		t.Fatal("didn't sync after retry")
+	}
+}
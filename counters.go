@@ -0,0 +1,238 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Counters records link and ethtool stat samples by ifindex to provide
+// deltas, rates, and short-term history.
+type Counters struct {
+	// Weight of the newest rate in the exponentially smoothed rate,
+	// 0 < Alpha <= 1, default 0.3
+	Alpha float64
+	// Samples kept per counter, default 16
+	History int
+	// Bits of hardware counters that wrap, e.g. 32 or 48; a decreasing
+	// count of 64 bit (default) counters is always a reset
+	Width uint
+
+	mutex    sync.RWMutex
+	counters map[CounterKey]*Counter
+}
+
+type CounterKey struct {
+	Ifindex int32
+	// XETH_MSG_KIND_LINK_STAT or XETH_MSG_KIND_ETHTOOL_STAT
+	Kind  Kind
+	Index uint64
+}
+
+type Counter struct {
+	Count uint64
+	Time  time.Time
+	// Change and per second rate of the last two samples
+	Delta uint64
+	Rate  float64
+	// Exponentially smoothed Rate
+	Smoothed float64
+	// Times count went backward other than by wraparound
+	Resets uint64
+
+	samples []CounterSample
+	next    int
+}
+
+type CounterSample struct {
+	Time  time.Time
+	Count uint64
+}
+
+// Record count of the given link or ethtool stat name.
+func (c *Counters) UpdateStat(ifindex int32, stat string, count uint64,
+	t time.Time) error {
+	kind, index, found := StatIndexOf(stat)
+	if !found {
+		return fmt.Errorf("%q unknown", stat)
+	}
+	c.Update(CounterKey{ifindex, kind, index}, count, t)
+	return nil
+}
+
+// Record a counter sample.
+func (c *Counters) Update(key CounterKey, count uint64, t time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.counters == nil {
+		c.counters = make(map[CounterKey]*Counter)
+	}
+	counter, found := c.counters[key]
+	if !found {
+		history := c.History
+		if history <= 0 {
+			history = 16
+		}
+		counter = &Counter{samples: make([]CounterSample, 0, history)}
+		c.counters[key] = counter
+	} else if t.After(counter.Time) {
+		delta := count - counter.Count
+		if count < counter.Count {
+			if c.wrapped(counter.Count) {
+				delta = count + (c.max() - counter.Count) + 1
+			} else {
+				counter.Resets++
+				delta = count
+			}
+		}
+		counter.Delta = delta
+		counter.Rate = float64(delta) / t.Sub(counter.Time).Seconds()
+		alpha := c.Alpha
+		if alpha <= 0 || alpha > 1 {
+			alpha = 0.3
+		}
+		if len(counter.samples) < 2 {
+			counter.Smoothed = counter.Rate
+		} else {
+			counter.Smoothed = (alpha * counter.Rate) +
+				((1 - alpha) * counter.Smoothed)
+		}
+	} else {
+		// ignore samples that are out of order
+		return
+	}
+	counter.Count = count
+	counter.Time = t
+	sample := CounterSample{t, count}
+	if len(counter.samples) < cap(counter.samples) {
+		counter.samples = append(counter.samples, sample)
+	} else {
+		counter.samples[counter.next] = sample
+	}
+	counter.next = (counter.next + 1) % cap(counter.samples)
+}
+
+// Return a copy of the counter.
+func (c *Counters) Get(key CounterKey) (Counter, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	counter, found := c.counters[key]
+	if !found {
+		return Counter{}, false
+	}
+	return counter.copy(), true
+}
+
+// Return the smoothed per second rate of the given link stat.
+func (c *Counters) LinkRate(ifindex int32, stat LinkStat) float64 {
+	counter, _ := c.Get(CounterKey{ifindex, XETH_MSG_KIND_LINK_STAT,
+		uint64(stat)})
+	return counter.Smoothed
+}
+
+// Return the smoothed per second rate of the given ethtool stat.
+func (c *Counters) EthtoolRate(ifindex int32, stat EthtoolStat) float64 {
+	counter, _ := c.Get(CounterKey{ifindex, XETH_MSG_KIND_ETHTOOL_STAT,
+		uint64(stat)})
+	return counter.Smoothed
+}
+
+// Call given function with a copy of each counter of ifindex ceasing on
+// error.
+func (c *Counters) Iterate(ifindex int32, f func(CounterKey, Counter) error) error {
+	c.mutex.RLock()
+	var keys []CounterKey
+	var counters []Counter
+	for key, counter := range c.counters {
+		if key.Ifindex == ifindex {
+			keys = append(keys, key)
+			counters = append(counters, counter.copy())
+		}
+	}
+	c.mutex.RUnlock()
+	for i := range keys {
+		if err := f(keys[i], counters[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Drop all counters of ifindex, e.g. once it's removed from the Ifcache.
+func (c *Counters) Forget(ifindex int32) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key := range c.counters {
+		if key.Ifindex == ifindex {
+			delete(c.counters, key)
+		}
+	}
+}
+
+func (c *Counters) max() uint64 {
+	if c.Width == 0 || c.Width >= 64 {
+		return ^uint64(0)
+	}
+	return (uint64(1) << c.Width) - 1
+}
+
+// A narrow counter has wrapped rather than reset if its last count was in
+// the upper half of its range.
+func (c *Counters) wrapped(last uint64) bool {
+	if c.Width == 0 || c.Width >= 64 {
+		return false
+	}
+	return last > c.max()/2
+}
+
+// Return the retained samples, oldest first.
+func (counter *Counter) History() []CounterSample {
+	n := len(counter.samples)
+	history := make([]CounterSample, 0, n)
+	if n == cap(counter.samples) {
+		history = append(history, counter.samples[counter.next:]...)
+		history = append(history, counter.samples[:counter.next]...)
+	} else {
+		history = append(history, counter.samples...)
+	}
+	return history
+}
+
+func (counter *Counter) copy() Counter {
+	dup := *counter
+	dup.samples = make([]CounterSample, len(counter.samples),
+		cap(counter.samples))
+	copy(dup.samples, counter.samples)
+	return dup
+}
+
+func (key CounterKey) String() string {
+	var stat fmt.Stringer = LinkStat(key.Index)
+	if key.Kind == XETH_MSG_KIND_ETHTOOL_STAT {
+		stat = EthtoolStat(key.Index)
+	}
+	return fmt.Sprint(key.Ifindex, ".", stat)
+}
@@ -0,0 +1,82 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCounters(t *testing.T) {
+	counters := Counters{Alpha: 0.5, History: 4, Width: 32}
+	key := CounterKey{3, XETH_MSG_KIND_LINK_STAT,
+		uint64(IndexofNetStatRxPackets)}
+	t0 := time.Unix(0, 0)
+	for i, count := range []uint64{
+		100,
+		1100,
+		3100,
+		// wrap
+		0xffffff00,
+		0xff,
+		// reset
+		50,
+	} {
+		counters.Update(key, count, t0.Add(time.Duration(i)*time.Second))
+	}
+	counter, found := counters.Get(key)
+	if !found {
+		t.Fatal("missing", key)
+	}
+	if counter.Delta != 50 || counter.Rate != 50 || counter.Resets != 1 {
+		t.Errorf("reset %+v", counter)
+	}
+	// the wrap from 0xffffff00 to 0xff counts 0x1ff
+	counters.Update(key, 0xffffff00, t0.Add(10*time.Second))
+	counters.Update(key, 0xff, t0.Add(11*time.Second))
+	if counter, _ = counters.Get(key); counter.Delta != 0x1ff ||
+		counter.Resets != 1 {
+		t.Errorf("wrap %+v", counter)
+	}
+	history := counter.History()
+	if len(history) != 4 || history[3].Count != 0xff ||
+		history[0].Count != 0xff {
+		t.Error("history", history)
+	}
+	for i, count := range []uint64{0, 100, 300} {
+		if err := counters.UpdateStat(4, "tx-bytes", count,
+			t0.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// (0.5 * 200) + (0.5 * 100)
+	if rate := counters.LinkRate(4,
+		LinkStat(IndexofNetStatTxBytes)); rate != 150 {
+		t.Error("smoothed rate", rate)
+	}
+	counters.Forget(3)
+	if _, found = counters.Get(key); found {
+		t.Error("didn't forget", key)
+	}
+}
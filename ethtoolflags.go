@@ -26,12 +26,24 @@ package xeth
 import (
 	"bytes"
 	"fmt"
+	"strings"
+	"unicode"
 )
 
 type EthtoolPrivFlags uint32
 
 var EthtoolPrivFlagNames []string
 
+// Return bit of the given ethtool private flag name, e.g. "fec91".
+func EthtoolPrivFlagOf(s string) (uint, bool) {
+	for i, name := range EthtoolPrivFlagNames {
+		if Hyphenate(name) == Hyphenate(s) {
+			return uint(i), true
+		}
+	}
+	return 0, false
+}
+
 func (bits *EthtoolPrivFlags) cache(args ...interface{}) {
 	for _, v := range args {
 		switch t := v.(type) {
@@ -68,3 +80,45 @@ func (bits EthtoolPrivFlags) Test(bit uint) bool {
 	mask := EthtoolPrivFlags(1 << bit)
 	return (bits & mask) == mask
 }
+
+// Parse flag names separated by space, comma, or '|', like "copper|fec74",
+// then set their bits; "none" sets nothing.
+func (bits *EthtoolPrivFlags) Parse(s string) error {
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '|' || unicode.IsSpace(r)
+	}) {
+		if name == "none" {
+			continue
+		}
+		if err := bits.Set(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set the named flag.
+func (bits *EthtoolPrivFlags) Set(name string) error {
+	bit, found := EthtoolPrivFlagOf(name)
+	if !found {
+		return fmt.Errorf("%q unknown", name)
+	}
+	*bits |= EthtoolPrivFlags(1) << bit
+	return nil
+}
+
+// Clear the named flag.
+func (bits *EthtoolPrivFlags) Clear(name string) error {
+	bit, found := EthtoolPrivFlagOf(name)
+	if !found {
+		return fmt.Errorf("%q unknown", name)
+	}
+	*bits &^= EthtoolPrivFlags(1) << bit
+	return nil
+}
+
+// Returns true if the named flag is set.
+func (bits EthtoolPrivFlags) Has(name string) bool {
+	bit, found := EthtoolPrivFlagOf(name)
+	return found && bits.Test(bit)
+}
@@ -0,0 +1,90 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import "testing"
+
+func TestEthtoolPrivFlags(t *testing.T) {
+	saved := EthtoolPrivFlagNames
+	defer func() { EthtoolPrivFlagNames = saved }()
+	EthtoolPrivFlagNames = []string{"copper", "fec74", "fec91"}
+
+	for _, x := range []struct {
+		s    string
+		want EthtoolPrivFlags
+		ok   bool
+	}{
+		{"", 0, true},
+		{"none", 0, true},
+		{"copper", 1, true},
+		{"copper|fec91", 5, true},
+		{"fec74, fec91", 6, true},
+		{"copper fec74\tfec91", 7, true},
+		{"fec108", 0, false},
+	} {
+		var bits EthtoolPrivFlags
+		err := bits.Parse(x.s)
+		if (err == nil) != x.ok || (x.ok && bits != x.want) {
+			t.Errorf("Parse(%q) = %b, %v", x.s, bits, err)
+		}
+	}
+
+	bits := EthtoolPrivFlags(1)
+	for _, x := range []struct {
+		op, name string
+		want     EthtoolPrivFlags
+		ok       bool
+	}{
+		{"set", "fec91", 5, true},
+		{"set", "fec91", 5, true},
+		{"clear", "copper", 4, true},
+		{"clear", "copper", 4, true},
+		{"set", "fec108", 4, false},
+		{"clear", "fec108", 4, false},
+	} {
+		var err error
+		if x.op == "set" {
+			err = bits.Set(x.name)
+		} else {
+			err = bits.Clear(x.name)
+		}
+		if (err == nil) != x.ok || bits != x.want {
+			t.Errorf("%s %s = %b, %v", x.op, x.name, bits, err)
+		}
+	}
+
+	for name, want := range map[string]bool{
+		"copper": false,
+		"fec74":  false,
+		"fec91":  true,
+		"fec108": false,
+	} {
+		if bits.Has(name) != want {
+			t.Errorf("%b has %s %v", bits, name, !want)
+		}
+	}
+	if s := EthtoolPrivFlags(5).String(); s != "copper|fec91" {
+		t.Error("String", s)
+	}
+}
@@ -0,0 +1,206 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	SIOCETHTOOL        = 0x8946
+	ETHTOOL_GSTRINGS   = 0x1b
+	ETHTOOL_GSSET_INFO = 0x37
+	ETH_SS_STATS       = 1
+	ETH_SS_PRIV_FLAGS  = 2
+	ETH_GSTRING_LEN    = 32
+)
+
+// If set, Start replaces the platform's ethtool flag and stat names with
+// those that the driver reports for its first port, after listing any
+// differences on stderr.
+var EthtoolDiscovery bool
+
+// A difference between a registered and discovered ethtool name
+type EthtoolNameMismatch struct {
+	Set             string
+	Index           int
+	Registered, Got string
+}
+
+type ifreqData struct {
+	name [IFNAMSIZ]byte
+	data unsafe.Pointer
+	_    [16]byte
+}
+
+// Return ethtool private flag and stat names of the given interface by
+// SIOCETHTOOL within its netns.
+func EthtoolNamesOf(entry *InterfaceEntry) (flags, stats []string, err error) {
+	get := func() error {
+		fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+		if err != nil {
+			return os.NewSyscallError("socket", err)
+		}
+		defer syscall.Close(fd)
+		flags, err = ethtoolStrings(fd, entry.Name, ETH_SS_PRIV_FLAGS)
+		if err != nil {
+			return err
+		}
+		stats, err = ethtoolStrings(fd, entry.Name, ETH_SS_STATS)
+		return err
+	}
+	if entry.Netns == DefaultNetns {
+		err = get()
+	} else {
+		err = entry.Netns.Do(get)
+	}
+	return
+}
+
+// Return differences of got from registered names.
+func EthtoolNameMismatches(set string, registered, got []string) []EthtoolNameMismatch {
+	var mismatches []EthtoolNameMismatch
+	n := len(registered)
+	if len(got) > n {
+		n = len(got)
+	}
+	for i := 0; i < n; i++ {
+		var r, g string
+		if i < len(registered) {
+			r = registered[i]
+		}
+		if i < len(got) {
+			g = got[i]
+		}
+		if Hyphenate(r) != Hyphenate(g) {
+			mismatches = append(mismatches, EthtoolNameMismatch{
+				Set:        set,
+				Index:      i,
+				Registered: r,
+				Got:        g,
+			})
+		}
+	}
+	return mismatches
+}
+
+func (m EthtoolNameMismatch) String() string {
+	return fmt.Sprintf("%s[%d] %q registered, %q discovered",
+		m.Set, m.Index, m.Registered, m.Got)
+}
+
+// Replace the ethtool names of the CurrentPlatform with those reported by the
+// first cached port, keeping the current names of a set that the port doesn't
+// report. Returns the differences of the replaced names.
+func DiscoverEthtoolNames() ([]EthtoolNameMismatch, error) {
+	var port *InterfaceEntry
+	Interface.Iterate(func(entry *InterfaceEntry) error {
+		if port == nil && entry.DevType == XETH_DEVTYPE_XETH_PORT {
+			port = entry
+		}
+		return nil
+	})
+	if port == nil {
+		return nil, fmt.Errorf("no port to discover ethtool names")
+	}
+	flags, stats, err := EthtoolNamesOf(port)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", port.Name, err)
+	}
+	return installEthtoolNames(flags, stats), nil
+}
+
+// Install a copy of the CurrentPlatform with the given, non-empty names.
+func installEthtoolNames(flags, stats []string) []EthtoolNameMismatch {
+	var mismatches []EthtoolNameMismatch
+	platform := *CurrentPlatform()
+	if len(flags) > 0 {
+		mismatches = append(mismatches,
+			EthtoolNameMismatches("priv-flags",
+				EthtoolPrivFlagNames, flags)...)
+		platform.EthtoolPrivFlagNames = flags
+	}
+	if len(stats) > 0 {
+		mismatches = append(mismatches,
+			EthtoolNameMismatches("stats",
+				EthtoolStatNames, stats)...)
+		platform.EthtoolStatNames = stats
+	}
+	platform.install()
+	return mismatches
+}
+
+func ethtoolIoctl(fd int, ifname string, data unsafe.Pointer) error {
+	var ifr ifreqData
+	copy(ifr.name[:IFNAMSIZ-1], ifname)
+	ifr.data = data
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd),
+		SIOCETHTOOL, uintptr(unsafe.Pointer(&ifr)))
+	if e != 0 {
+		return os.NewSyscallError("SIOCETHTOOL", e)
+	}
+	return nil
+}
+
+func ethtoolStrings(fd int, ifname string, set uint32) ([]string, error) {
+	var info struct {
+		cmd      uint32
+		reserved uint32
+		mask     uint64
+		data     [1]uint32
+	}
+	info.cmd = ETHTOOL_GSSET_INFO
+	info.mask = 1 << set
+	if err := ethtoolIoctl(fd, ifname, unsafe.Pointer(&info)); err != nil {
+		return nil, err
+	}
+	if info.mask == 0 || info.data[0] == 0 {
+		return nil, nil
+	}
+	n := int(info.data[0])
+	buf := make([]byte, 12+(n*ETH_GSTRING_LEN))
+	gstrings := (*struct {
+		cmd, set, len uint32
+	})(unsafe.Pointer(&buf[0]))
+	gstrings.cmd = ETHTOOL_GSTRINGS
+	gstrings.set = set
+	gstrings.len = uint32(n)
+	if err := ethtoolIoctl(fd, ifname, unsafe.Pointer(&buf[0])); err != nil {
+		return nil, err
+	}
+	n = int(gstrings.len)
+	names := make([]string, n)
+	for i := range names {
+		b := buf[12+(i*ETH_GSTRING_LEN) : 12+((i+1)*ETH_GSTRING_LEN)]
+		if j := bytes.IndexByte(b, 0); j >= 0 {
+			b = b[:j]
+		}
+		names[i] = string(b)
+	}
+	return names, nil
+}
@@ -0,0 +1,112 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEthtoolNameMismatches(t *testing.T) {
+	for _, x := range []struct {
+		registered, got []string
+		want            []EthtoolNameMismatch
+	}{
+		{
+			[]string{"copper", "fec-74"},
+			[]string{"copper", "fec_74"},
+			nil,
+		},
+		{
+			[]string{"copper", "fec74", "fec91"},
+			[]string{"copper", "fec91"},
+			[]EthtoolNameMismatch{
+				{"priv-flags", 1, "fec74", "fec91"},
+				{"priv-flags", 2, "fec91", ""},
+			},
+		},
+		{
+			nil,
+			[]string{"copper"},
+			[]EthtoolNameMismatch{
+				{"priv-flags", 0, "", "copper"},
+			},
+		},
+	} {
+		got := EthtoolNameMismatches("priv-flags", x.registered, x.got)
+		if !reflect.DeepEqual(got, x.want) {
+			t.Errorf("%q, %q: %v", x.registered, x.got, got)
+		}
+	}
+}
+
+func TestInstallEthtoolNames(t *testing.T) {
+	savedPlatform := xeth.platform
+	savedFlags, savedStats := EthtoolPrivFlagNames, EthtoolStatNames
+	defer func() {
+		xeth.platform = savedPlatform
+		EthtoolPrivFlagNames, EthtoolStatNames = savedFlags, savedStats
+		EthtoolStatMap = nil
+	}()
+	registered := &Platform{
+		Name:                 "test",
+		EthtoolPrivFlagNames: []string{"copper", "fec74"},
+		EthtoolStatNames:     []string{"test-a"},
+	}
+	registered.install()
+	generation := ethtoolNamesGeneration
+
+	mismatches := installEthtoolNames(nil, []string{"test-a", "test-b"})
+	if len(mismatches) != 1 || mismatches[0].Got != "test-b" {
+		t.Error("mismatches", mismatches)
+	}
+	if len(EthtoolPrivFlagNames) != 2 {
+		t.Error("replaced flags with none")
+	}
+	platform := CurrentPlatform()
+	if platform == registered || platform.Name != "test" ||
+		len(platform.EthtoolStatNames) != 2 ||
+		len(platform.EthtoolPrivFlagNames) != 2 {
+		t.Errorf("current %+v", platform)
+	}
+	if len(registered.EthtoolStatNames) != 1 {
+		t.Error("changed registered platform")
+	}
+	if _, index, found := StatIndexOf("test-b"); !found || index != 1 {
+		t.Error("test-b", index, found)
+	}
+	if ethtoolNamesGeneration == generation {
+		t.Error("same generation")
+	}
+
+	// another platform replaces all of the previous names
+	Generic.install()
+	if !reflect.DeepEqual(EthtoolPrivFlagNames, appEthtoolNames.flags) ||
+		!reflect.DeepEqual(EthtoolStatNames, appEthtoolNames.stats) {
+		t.Error("generic kept", EthtoolPrivFlagNames, EthtoolStatNames)
+	}
+	if _, _, found := StatIndexOf("test-b"); found {
+		t.Error("generic kept test-b")
+	}
+}
@@ -23,6 +23,11 @@
 
 package xeth
 
+import (
+	"reflect"
+	"unsafe"
+)
+
 type Supported EthtoolLinkModeBits
 type Advertising EthtoolLinkModeBits
 type Partner EthtoolLinkModeBits
@@ -35,6 +40,8 @@ type EthtoolSettings struct {
 	Supported
 	Advertising
 	Partner
+	// Words per link mode mask in the driver's reports, zero until reported
+	Nwords int
 }
 
 func (p *EthtoolSettings) cache(args ...interface{}) {
@@ -42,12 +49,17 @@ func (p *EthtoolSettings) cache(args ...interface{}) {
 		switch t := v.(type) {
 		case *MsgEthtoolSettings:
 			p.Speed = Mbps(t.Speed)
+			p.Autoneg = Autoneg(t.Autoneg)
 			p.Duplex = Duplex(t.Duplex)
 			p.DevPort = DevPort(t.Port)
-			p.Supported = *(*Supported)(&t.Link_modes_supported)
-			p.Advertising =
-				*(*Advertising)(&t.Link_modes_advertising)
-			p.Partner = *(*Partner)(&t.Link_modes_lp_advertising)
+			p.Nwords = t.Nwords()
+			supported, advertising, partner := t.LinkModeMasks()
+			p.Supported = Supported{}
+			copy(p.Supported[:], supported)
+			p.Advertising = Advertising{}
+			copy(p.Advertising[:], advertising)
+			p.Partner = Partner{}
+			copy(p.Partner[:], partner)
 		case Mbps:
 			p.Speed = t
 		case Duplex:
@@ -65,3 +77,40 @@ func (p *EthtoolSettings) cache(args ...interface{}) {
 		}
 	}
 }
+
+// Size of the generated MsgEthtoolSettings link mode masks
+const XETH_LINK_MODE_MASKS_NWORDS = len(MsgEthtoolSettings{}.Link_modes_supported)
+
+const offsetofLinkModeMasks = SizeofMsgEthtoolSettings -
+	(3 * 4 * XETH_LINK_MODE_MASKS_NWORDS)
+
+// Return size of a MsgEthtoolSettings with nwords per link mode mask.
+func SizeofMsgEthtoolSettingsNwords(nwords int) int {
+	return offsetofLinkModeMasks + (3 * 4 * nwords)
+}
+
+// Return number of words in each link mode mask.
+func (msg *MsgEthtoolSettings) Nwords() int {
+	if msg.Link_mode_masks_nwords <= 0 {
+		return XETH_LINK_MODE_MASKS_NWORDS
+	}
+	return int(msg.Link_mode_masks_nwords)
+}
+
+// Return the supported, advertising, and partner link mode masks that, like
+// the kernel's ethtool_link_settings, follow the fixed length settings in
+// Link_mode_masks_nwords sized sequence. The message must have been
+// allocated or validated with SizeofMsgEthtoolSettingsNwords(msg.Nwords()).
+func (msg *MsgEthtoolSettings) LinkModeMasks() (supported, advertising,
+	partner []uint32) {
+	var masks []uint32
+	n := msg.Nwords()
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&masks))
+	hdr.Data = uintptr(unsafe.Pointer(&msg.Link_modes_supported[0]))
+	hdr.Len = 3 * n
+	hdr.Cap = 3 * n
+	supported = masks[:n:n]
+	advertising = masks[n : 2*n : 2*n]
+	partner = masks[2*n : 3*n : 3*n]
+	return
+}
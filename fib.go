@@ -95,14 +95,15 @@ func (event FibNHEvent) String() string {
 	return s
 }
 
+// Return the next hops that follow the fib entry. The message must have been
+// validated with SizeofMsgFibentry + Nhs*SizeofNextHop.
 func (fe *MsgFibentry) NextHops() []NextHop {
-	ptr := unsafe.Pointer(fe)
-	nhs := int(fe.Nhs)
-	return *(*[]NextHop)(unsafe.Pointer(&reflect.SliceHeader{
-		Data: uintptr(ptr) + uintptr(SizeofMsgFibentry),
-		Len:  nhs,
-		Cap:  nhs,
-	}))
+	var nhs []NextHop
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&nhs))
+	hdr.Data = uintptr(unsafe.Pointer(fe)) + SizeofMsgFibentry
+	hdr.Len = int(fe.Nhs)
+	hdr.Cap = int(fe.Nhs)
+	return nhs
 }
 
 func (fe *MsgFibentry) Prefix() *net.IPNet {
@@ -0,0 +1,268 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// Number of kinds sized by MsgHello
+const XETH_HELLO_NKINDS = 32
+
+const SizeofMsgHello = 0x58
+
+// Start and the driver exchange hello messages with their version and the
+// size of each supported kind, or zero if unsupported. Variable length kinds
+// have the size of their fixed part.
+type MsgHello struct {
+	Z64                 uint64
+	Z32                 uint32
+	Z16                 uint16
+	Z8                  uint8
+	Kind                uint8
+	Major, Minor, Patch uint16
+	Nkinds              uint8
+	Pad                 uint8
+	Sizes               [XETH_HELLO_NKINDS]uint16
+}
+
+func ToMsgHello(buf []byte) *MsgHello {
+	return (*MsgHello)(unsafe.Pointer(&buf[0]))
+}
+
+// Time that Start waits for the driver's hello before assuming the legacy
+// protocol of the original kinds; zero disables the handshake. A legacy
+// driver doesn't reply to hello but does to the ifinfo dump request that
+// follows, so Start concludes legacy with the first dumped ifinfo or break
+// and only waits this long for a driver that doesn't reply at all. Other
+// messages, like a link change, may precede the hello and don't count.
+//
+// This relies on the original driver dropping a message of unknown kind, as
+// the sim.Simulator does with Legacy; if a driver instead closes the socket,
+// Start returns ErrHelloClosed rather than assume legacy.
+var HelloTimeout = 250 * time.Millisecond
+
+// ErrHelloClosed is returned by Start if the driver closes the socket before
+// replying to hello or the ifinfo dump request.
+var ErrHelloClosed = errors.New("xeth driver closed socket after hello")
+
+// VersionError is returned by Start if the driver's protocol is incompatible.
+type VersionError struct {
+	Library, Driver string
+}
+
+func (err *VersionError) Error() string {
+	return fmt.Sprint("xeth library ", err.Library,
+		" is incompatible with driver ", err.Driver)
+}
+
+// UnsupportedError is returned when sending a kind that the driver doesn't
+// support.
+type UnsupportedError struct {
+	Kind
+}
+
+func (err *UnsupportedError) Error() string {
+	return fmt.Sprint(err.Kind, " unsupported by driver ", DriverVersion())
+}
+
+// Return the size of each kind known to the library.
+func KindSizes() [XETH_HELLO_NKINDS]uint16 {
+	var sizes [XETH_HELLO_NKINDS]uint16
+	for kind, size := range map[Kind]int{
+		XETH_MSG_KIND_BREAK:            SizeofMsgBreak,
+		XETH_MSG_KIND_LINK_STAT:        SizeofMsgStat,
+		XETH_MSG_KIND_ETHTOOL_STAT:     SizeofMsgStat,
+		XETH_MSG_KIND_ETHTOOL_FLAGS:    SizeofMsgEthtoolFlags,
+		XETH_MSG_KIND_ETHTOOL_SETTINGS: offsetofLinkModeMasks,
+		XETH_MSG_KIND_DUMP_IFINFO:      SizeofMsgDumpIfinfo,
+		XETH_MSG_KIND_CARRIER:          SizeofMsgCarrier,
+		XETH_MSG_KIND_SPEED:            SizeofMsgSpeed,
+		XETH_MSG_KIND_IFINFO:           SizeofMsgIfinfo,
+		XETH_MSG_KIND_IFA:              SizeofMsgIfa,
+		XETH_MSG_KIND_DUMP_FIBINFO:     SizeofMsgDumpFibinfo,
+		XETH_MSG_KIND_FIBENTRY:         SizeofMsgFibentry,
+		XETH_MSG_KIND_NEIGH_UPDATE:     SizeofMsgNeighUpdate,
+		XETH_MSG_KIND_CHANGE_UPPER:     SizeofMsgChangeUpper,
+		XETH_MSG_KIND_STATS:            SizeofMsgStats,
+		XETH_MSG_KIND_ACK:              SizeofMsgAck,
+		XETH_MSG_KIND_NAK:              SizeofMsgAck,
+		XETH_MSG_KIND_HELLO:            SizeofMsgHello,
+		XETH_MSG_KIND_IFDEL:            SizeofMsgIfdel,
+		XETH_MSG_KIND_IFVID:            SizeofMsgIfvid,
+	} {
+		sizes[kind] = uint16(size)
+	}
+	return sizes
+}
+
+// Return the major, minor, and patch numbers of a "v<MAJOR>.<MINOR>.<PATCH>"
+// version.
+func ParseVersion(s string) (major, minor, patch uint16, err error) {
+	v := strings.TrimPrefix(s, "v")
+	if i := strings.Index(v, "-"); i >= 0 {
+		v = v[:i]
+	}
+	fields := strings.Split(v, ".")
+	if len(fields) != 3 {
+		err = fmt.Errorf("version %q invalid", s)
+		return
+	}
+	var n [3]uint16
+	for i, field := range fields {
+		u, perr := strconv.ParseUint(field, 10, 16)
+		if perr != nil {
+			err = fmt.Errorf("version %q invalid", s)
+			return
+		}
+		n[i] = uint16(u)
+	}
+	return n[0], n[1], n[2], nil
+}
+
+// Return the driver's version from its hello, or "" if legacy.
+func DriverVersion() string {
+	return xeth.driver.version
+}
+
+// Returns true if the driver supports the given kind as sized by the library.
+func Supports(kind Kind) bool {
+	if !xeth.driver.negotiated || kind == XETH_MSG_KIND_HELLO {
+		return true
+	}
+	if int(kind) >= len(xeth.driver.supports) {
+		return false
+	}
+	return xeth.driver.supports[kind]
+}
+
+// Send hello and an ifinfo dump request then negotiate supported kinds with
+// the driver's reply, or assume a legacy driver if it first replies to the
+// dump.
+func hello() error {
+	xeth.driver.negotiated = false
+	xeth.driver.version = ""
+	if HelloTimeout == 0 {
+		return DumpIfinfo()
+	}
+	major, minor, patch, err := ParseVersion(Version)
+	if err != nil {
+		return err
+	}
+	// discard a stale reply
+	select {
+	case buf := <-xeth.hello:
+		Pool.Put(buf)
+	default:
+	}
+	buf := Pool.Get(SizeofMsgHello)
+	defer Pool.Put(buf)
+	msg := ToMsgHello(buf)
+	msg.Kind = XETH_MSG_KIND_HELLO
+	msg.Major, msg.Minor, msg.Patch = major, minor, patch
+	msg.Nkinds = XETH_HELLO_NKINDS
+	msg.Sizes = KindSizes()
+	if err = tx(buf, HelloTimeout); err != nil {
+		return err
+	}
+	if err = DumpIfinfo(); err != nil {
+		return err
+	}
+	timer := time.NewTimer(HelloTimeout)
+	defer timer.Stop()
+	select {
+	case reply := <-xeth.hello:
+		defer Pool.Put(reply)
+		return negotiate(msg, ToMsgHello(reply))
+	case _, ok := <-xeth.dumping:
+		// gorx passes a hello before the dump that follows it
+		select {
+		case reply := <-xeth.hello:
+			defer Pool.Put(reply)
+			return negotiate(msg, ToMsgHello(reply))
+		default:
+		}
+		if !ok {
+			return ErrHelloClosed
+		}
+		legacy()
+		return nil
+	case <-timer.C:
+		legacy()
+		return nil
+	}
+}
+
+// Support only the original kinds of a driver without hello.
+func legacy() {
+	for kind := range xeth.driver.supports {
+		xeth.driver.supports[kind] = kind < XETH_MSG_KIND_STATS
+	}
+	xeth.driver.negotiated = true
+}
+
+func negotiate(local, remote *MsgHello) error {
+	xeth.driver.version = fmt.Sprintf("v%d.%d.%d", remote.Major,
+		remote.Minor, remote.Patch)
+	if remote.Major != local.Major {
+		return &VersionError{Version, xeth.driver.version}
+	}
+	var degraded []string
+	for kind := range xeth.driver.supports {
+		var size uint16
+		if kind < int(remote.Nkinds) && kind < len(remote.Sizes) {
+			size = remote.Sizes[kind]
+		}
+		want := local.Sizes[kind]
+		xeth.driver.supports[kind] = size != 0 && want != 0 &&
+			size == want
+		if size != 0 && want != 0 && !xeth.driver.supports[kind] {
+			degraded = append(degraded, fmt.Sprint(Kind(kind),
+				" size ", size, " != ", want))
+		}
+	}
+	xeth.driver.negotiated = true
+	if len(degraded) > 0 {
+		fmt.Fprintln(os.Stderr, "xeth driver", xeth.driver.version,
+			"unsupported:", strings.Join(degraded, ", "))
+	}
+	return nil
+}
+
+// Called by gorx with the driver's hello.
+func helloed(buf []byte) {
+	msg := Pool.Get(len(buf))
+	copy(msg, buf)
+	select {
+	case xeth.hello <- msg:
+	default:
+		Pool.Put(msg)
+	}
+}
@@ -0,0 +1,146 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	saved := xeth.driver
+	defer func() { xeth.driver = saved }()
+	var local, remote MsgHello
+	local.Major, local.Minor = 1, 1
+	local.Nkinds = XETH_HELLO_NKINDS
+	local.Sizes = KindSizes()
+	remote = local
+	remote.Minor = 2
+	remote.Sizes[XETH_MSG_KIND_SPEED] += 8
+	remote.Sizes[XETH_MSG_KIND_ACK] = 0
+	if err := negotiate(&local, &remote); err != nil {
+		t.Fatal(err)
+	}
+	if DriverVersion() != "v1.2.0" {
+		t.Error("driver version", DriverVersion())
+	}
+	for kind, want := range map[Kind]bool{
+		XETH_MSG_KIND_CARRIER: true,
+		XETH_MSG_KIND_STATS:   true,
+		XETH_MSG_KIND_SPEED:   false,
+		XETH_MSG_KIND_ACK:     false,
+	} {
+		if Supports(kind) != want {
+			t.Error(kind, "supported", !want)
+		}
+	}
+	remote.Major = 2
+	if _, ok := negotiate(&local, &remote).(*VersionError); !ok {
+		t.Error("accepted major version 2")
+	}
+	legacy()
+	if Supports(XETH_MSG_KIND_STATS) || !Supports(XETH_MSG_KIND_SPEED) {
+		t.Error("legacy kinds")
+	}
+}
+
+// Run hello against a peer that replies with the given messages, a few
+// milliseconds apart, after it receives the hello and dump request; nil
+// closes the socket instead.
+func testHello(t *testing.T, replies ...[]byte) error {
+	testCache(t)
+	peer := pairSock(t)
+	xeth.rxch = make(chan []byte, 4)
+	xeth.hello = make(chan []byte, 1)
+	xeth.dumping = make(chan struct{}, 1)
+	xeth.rxbreak = make(chan struct{}, 1)
+	go gorx()
+	go func() {
+		buf := make([]byte, PageSize)
+		for i := 0; i < 2; i++ {
+			if _, err := peer.Read(buf); err != nil {
+				return
+			}
+		}
+		for _, reply := range replies {
+			if reply == nil {
+				peer.Close()
+				return
+			}
+			peer.Write(reply)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	err := hello()
+	peer.Close()
+	for buf := range xeth.rxch {
+		Pool.Put(buf)
+	}
+	return err
+}
+
+// Only a hello, dumped ifinfo, or break ends the handshake.
+func TestHelloReplies(t *testing.T) {
+	ifinfo := func(reason uint8) []byte {
+		buf := make([]byte, SizeofMsgIfinfo)
+		msg := ToMsgIfinfo(buf)
+		msg.Kind = XETH_MSG_KIND_IFINFO
+		copy(msg.Ifname[:], "t20")
+		msg.Net = uint64(DefaultNetns)
+		msg.Ifindex = 1020
+		msg.Reason = reason
+		return buf
+	}
+	reply := make([]byte, SizeofMsgHello)
+	msg := ToMsgHello(reply)
+	msg.Kind = XETH_MSG_KIND_HELLO
+	msg.Major, msg.Minor, msg.Patch, _ = ParseVersion(Version)
+	msg.Nkinds = XETH_HELLO_NKINDS
+	msg.Sizes = KindSizes()
+	for _, x := range []struct {
+		name    string
+		replies [][]byte
+		version string
+		err     error
+	}{
+		{"event before hello", [][]byte{
+			ifinfo(XETH_IFINFO_REASON_NEW), reply}, Version, nil},
+		{"dump", [][]byte{ifinfo(XETH_IFINFO_REASON_DUMP)}, "", nil},
+		{"break", [][]byte{make([]byte, SizeofMsgBreak)}, "", nil},
+		{"closed", [][]byte{nil}, "", ErrHelloClosed},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			begin := time.Now()
+			if err := testHello(t, x.replies...); err != x.err {
+				t.Fatal(err)
+			}
+			if took := time.Since(begin); took >= HelloTimeout {
+				t.Error("took", took)
+			}
+			if x.err == nil && DriverVersion() != x.version {
+				t.Error("driver version", DriverVersion())
+			}
+		})
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"fmt"
 	"net"
 	"sort"
+	"sync"
 )
 
 type NoValue struct{}
@@ -42,42 +43,152 @@ type InterfaceEntry struct {
 	Lowers Associates
 }
 
+// Ifcache is written by the receive routine and by the Set* functions that
+// cache what they send, so its maps are guarded by mutex.
 type Ifcache struct {
+	mutex   sync.RWMutex
 	indexes []int32
 	index   map[int32]*InterfaceEntry
 	// only map XETH_DEVTYPE_XETH_PORT by name
 	dir map[string]*InterfaceEntry
+	// map all interfaces by name within each netns
+	netns map[Netns]map[string]*InterfaceEntry
 }
 
 var Interface Ifcache
 
 func (c *Ifcache) Indexed(ifindex int32) *InterfaceEntry {
-	if entry, found := c.index[ifindex]; found {
+	if entry := c.cached(ifindex); entry != nil {
 		return entry
 	}
-	if p, err := net.InterfaceByIndex(int(ifindex)); err == nil {
-		return c.cache(int32(p.Index), p)
-	}
-	return nil
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.indexed(ifindex)
 }
 
 // Call given function with each cached interface entry ceasing on error.
 func (c *Ifcache) Iterate(f func(*InterfaceEntry) error) error {
-	sort.Slice(c.indexes, func(i, j int) bool {
-		return c.indexes[i] < c.indexes[j]
-	})
+	c.mutex.RLock()
+	entries := make([]*InterfaceEntry, 0, len(c.indexes))
 	for _, ifindex := range c.indexes {
-		if err := f(c.index[ifindex]); err != nil {
-			return err
-		}
+		entries = append(entries, c.index[ifindex])
 	}
-	return nil
+	c.mutex.RUnlock()
+	return iterate(entries, f)
+}
+
+// Call given function with each named interface entry of the given netns, in
+// ifindex order, ceasing on error.
+func (c *Ifcache) InNetns(netns Netns, f func(*InterfaceEntry) error) error {
+	c.mutex.RLock()
+	dir := c.netns[netns]
+	entries := make([]*InterfaceEntry, 0, len(dir))
+	for _, entry := range dir {
+		entries = append(entries, entry)
+	}
+	c.mutex.RUnlock()
+	return iterate(entries, f)
 }
 
 func (c *Ifcache) Named(name string) *InterfaceEntry {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 	return c.dir[name]
 }
 
+// Return the interface entry of the given name within netns.
+func (c *Ifcache) NamedIn(netns Netns, name string) *InterfaceEntry {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.netns[netns][name]
+}
+
+// Return the cached entry without looking up an uncached interface.
+func (c *Ifcache) cached(ifindex int32) *InterfaceEntry {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.index[ifindex]
+}
+
+// Return the words per link mode mask of the interface's ethtool settings
+// as reported by the driver or, before any report, of the generated message.
+func (c *Ifcache) nwords(ifindex int32) (int, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	entry, found := c.index[ifindex]
+	if !found {
+		return 0, false
+	}
+	if entry.EthtoolSettings.Nwords > 0 {
+		return entry.EthtoolSettings.Nwords, true
+	}
+	return XETH_LINK_MODE_MASKS_NWORDS, true
+}
+
+// Cache the given attributes of an interface reported by the driver from
+// outside of the receive routine.
+func (c *Ifcache) set(ifindex int32, args ...interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, found := c.index[ifindex]
+	if !found {
+		return fmt.Errorf("ifindex %d unknown", ifindex)
+	}
+	entry.cache(args...)
+	return nil
+}
+
+// Return a copy of each entry, in ifindex order, for readers like
+// PrometheusExporter and IfMibOf that mustn't race the receive routine. The
+// copies have their own IPNets, Uppers, and Lowers.
+func (c *Ifcache) snapshot() []InterfaceEntry {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	entries := make([]InterfaceEntry, 0, len(c.indexes))
+	for _, ifindex := range c.indexes {
+		entry := *c.index[ifindex]
+		entry.IPNets = append([]*net.IPNet(nil), entry.IPNets...)
+		entry.Uppers = entry.Uppers.clone()
+		entry.Lowers = entry.Lowers.clone()
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Index < entries[j].Index
+	})
+	return entries
+}
+
+// Clear the cache on Stop.
+func (c *Ifcache) reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.indexes = c.indexes[:0]
+	for ifindex := range c.index {
+		delete(c.index, ifindex)
+	}
+	c.index = nil
+	for name := range c.dir {
+		delete(c.dir, name)
+	}
+	c.dir = nil
+	for netns := range c.netns {
+		delete(c.netns, netns)
+	}
+	c.netns = nil
+}
+
+// The remaining Ifcache methods expect the caller to hold the mutex.
+
+func (c *Ifcache) indexed(ifindex int32) *InterfaceEntry {
+	if entry, found := c.index[ifindex]; found {
+		return entry
+	}
+	if p, err := net.InterfaceByIndex(int(ifindex)); err == nil {
+		return c.cache(int32(p.Index), p)
+	}
+	return nil
+}
+
 func (c *Ifcache) cache(ifindex int32, args ...interface{}) *InterfaceEntry {
 	entry, found := c.index[ifindex]
 	if !found {
@@ -88,12 +199,15 @@ func (c *Ifcache) cache(ifindex int32, args ...interface{}) *InterfaceEntry {
 }
 
 func (c *Ifcache) del(ifindex int32) {
-	if entry := c.Indexed(ifindex); entry != nil {
+	if entry := c.index[ifindex]; entry != nil {
 		if len(entry.IPNets) > 0 {
 			entry.IPNets = entry.IPNets[:0]
 		}
 		delete(c.index, ifindex)
-		delete(c.dir, entry.String())
+		if c.dir[entry.Name] == entry {
+			delete(c.dir, entry.Name)
+		}
+		c.unname(entry)
 		for i := range c.indexes {
 			if c.indexes[i] == ifindex {
 				copy(c.indexes[i:], c.indexes[i+1:])
@@ -104,6 +218,31 @@ func (c *Ifcache) del(ifindex int32) {
 	}
 }
 
+// Map entry by name in its netns.
+func (c *Ifcache) name(entry *InterfaceEntry) {
+	if len(entry.Name) == 0 {
+		return
+	}
+	dir, found := c.netns[entry.Netns]
+	if !found {
+		dir = make(map[string]*InterfaceEntry)
+		c.netns[entry.Netns] = dir
+	}
+	dir[entry.Name] = entry
+}
+
+// Unmap entry by name from its netns.
+func (c *Ifcache) unname(entry *InterfaceEntry) {
+	dir, found := c.netns[entry.Netns]
+	if !found || dir[entry.Name] != entry {
+		return
+	}
+	delete(dir, entry.Name)
+	if len(dir) == 0 {
+		delete(c.netns, entry.Netns)
+	}
+}
+
 func (c *Ifcache) newEntry(ifindex int32) *InterfaceEntry {
 	entry := new(InterfaceEntry)
 	entry.Index = ifindex
@@ -170,16 +309,16 @@ func (entry *InterfaceEntry) cache(args ...interface{}) {
 			// don't override Index set by newEntry
 			entry.dub(t.Name)
 			entry.Link = -1
-			entry.Netns = DefaultNetns
+			entry.move(DefaultNetns)
 			copy(entry.addr[:], t.HardwareAddr)
-			entry.Flags = t.Flags
+			entry.Flags = ifflagsOf(t.Flags)
 			entry.DevType = XETH_DEVTYPE_LINUX_UNKNOWN
 			entry.Reason = XETH_IFINFO_REASON_NEW
 			entry.Id = 0
 			entry.Port = -1
 			entry.Subport = -1
 		case *MsgChangeUpper:
-			upper := Interface.Indexed(t.Upper)
+			upper := Interface.indexed(t.Upper)
 			if entry.Uppers == nil {
 				entry.Uppers = make(Associates)
 			}
@@ -191,12 +330,12 @@ func (entry *InterfaceEntry) cache(args ...interface{}) {
 				upper.Lowers.Add(t.Lower)
 			} else {
 				entry.Uppers.Del(t.Upper)
-				entry.Uppers.Del(t.Lower)
+				upper.Lowers.Del(t.Lower)
 			}
 		case *MsgIfinfo:
 			entry.dub((*Ifname)(&t.Ifname).String())
 			entry.Link = t.Iflinkindex
-			entry.Netns = Netns(t.Net)
+			entry.move(Netns(t.Net))
 			copy(entry.addr[:], t.Addr[:])
 			entry.Ifinfo.Flags = net.Flags(t.Flags)
 			entry.DevType = DevType(t.Devtype)
@@ -213,7 +352,7 @@ func (entry *InterfaceEntry) cache(args ...interface{}) {
 		case net.Flags:
 			entry.Flags = t
 		case Netns:
-			entry.Netns = t
+			entry.move(t)
 		case *MsgIfa:
 			switch t.Event {
 			case IFA_ADD:
@@ -246,6 +385,10 @@ func (entry *InterfaceEntry) cache(args ...interface{}) {
 			entry.EthtoolSettings.cache(t)
 		case Autoneg:
 			entry.EthtoolSettings.cache(t)
+		case *Supported:
+			entry.EthtoolSettings.cache(t)
+		case *Advertising:
+			entry.EthtoolSettings.cache(t)
 		}
 	}
 }
@@ -260,13 +403,49 @@ func (entry *InterfaceEntry) dub(name string) {
 		}
 		Interface.dir[name] = entry
 	}
+	Interface.unname(entry)
 	entry.Name = name
+	Interface.name(entry)
+}
+
+// Remap entry by name from its current to the given netns.
+func (entry *InterfaceEntry) move(netns Netns) {
+	if entry.Netns == netns {
+		return
+	}
+	Interface.unname(entry)
+	entry.Netns = netns
+	Interface.name(entry)
+}
+
+// Call given function with each entry in ifindex order ceasing on error.
+func iterate(entries []*InterfaceEntry, f func(*InterfaceEntry) error) error {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Index < entries[j].Index
+	})
+	for _, entry := range entries {
+		if err := f(entry); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (associates Associates) NotEmpty() bool {
 	return associates != nil && len(associates) > 0
 }
 
+func (associates Associates) clone() Associates {
+	if associates == nil {
+		return nil
+	}
+	clone := make(Associates, len(associates))
+	for ifindex := range associates {
+		clone.Add(ifindex)
+	}
+	return clone
+}
+
 func (associates Associates) Add(ifindex int32) {
 	associates[ifindex] = NoValue{}
 }
@@ -0,0 +1,133 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import "testing"
+
+// Skip tests that need the Interface cache of a started driver.
+func needDriver(t *testing.T) {
+	if xeth.sock == nil {
+		t.Skip("no driver")
+	}
+}
+
+// Give the test an empty Interface cache unless a driver has started.
+func testCache(t *testing.T) {
+	if xeth.sock != nil {
+		return
+	}
+	Interface.mutex.Lock()
+	Interface.index = make(map[int32]*InterfaceEntry)
+	Interface.dir = make(map[string]*InterfaceEntry)
+	Interface.netns = make(map[Netns]map[string]*InterfaceEntry)
+	Interface.mutex.Unlock()
+	t.Cleanup(Interface.reset)
+}
+
+// Cache a test entry as though the driver had reported it.
+func testEntry(ifindex int32, args ...interface{}) {
+	Interface.mutex.Lock()
+	defer Interface.mutex.Unlock()
+	Interface.cache(ifindex, args...)
+}
+
+func TestIfcacheNetns(t *testing.T) {
+	needDriver(t)
+	const (
+		netns Netns = 0x7e57
+		other Netns = 0x7e58
+	)
+	names := func(netns Netns) (s []string) {
+		Interface.InNetns(netns, func(entry *InterfaceEntry) error {
+			s = append(s, entry.Name)
+			return nil
+		})
+		return
+	}
+	del := func(ifindex int32) {
+		Interface.mutex.Lock()
+		defer Interface.mutex.Unlock()
+		Interface.del(ifindex)
+	}
+	defer del(1001)
+	defer del(1000)
+	if err := Interface.set(1001, "t1"); err == nil {
+		t.Fatal("set unknown ifindex")
+	}
+	if Interface.cached(1001) != nil {
+		t.Fatal("set cached unknown ifindex")
+	}
+	testEntry(1001, "t1", netns)
+	testEntry(1000, "t0", netns)
+	if s := names(netns); len(s) != 2 || s[0] != "t0" || s[1] != "t1" {
+		t.Fatal("InNetns", s)
+	}
+	if entry := Interface.NamedIn(netns, "t1"); entry == nil ||
+		entry.Index != 1001 {
+		t.Fatal("NamedIn", entry)
+	}
+	if Interface.NamedIn(DefaultNetns, "t1") != nil {
+		t.Error("t1 in default netns")
+	}
+
+	// rename
+	Interface.set(1001, "t2")
+	if Interface.NamedIn(netns, "t1") != nil {
+		t.Error("stale t1")
+	}
+	if entry := Interface.NamedIn(netns, "t2"); entry == nil ||
+		entry.Index != 1001 {
+		t.Error("NamedIn t2", entry)
+	}
+
+	// move
+	Interface.set(1001, other)
+	if Interface.NamedIn(netns, "t2") != nil {
+		t.Error("stale t2 after move")
+	}
+	if s := names(other); len(s) != 1 || s[0] != "t2" {
+		t.Error("moved", s)
+	}
+	if s := names(netns); len(s) != 1 || s[0] != "t0" {
+		t.Error("remaining", s)
+	}
+
+	// another entry of the same name mustn't be unnamed by the first
+	Interface.set(1000, other)
+	Interface.set(1000, "t2")
+	Interface.set(1001, "t3")
+	if entry := Interface.NamedIn(other, "t2"); entry == nil ||
+		entry.Index != 1000 {
+		t.Error("t2 of 1000", entry)
+	}
+
+	del(1000)
+	del(1001)
+	if _, found := Interface.netns[other]; found {
+		t.Error("empty netns retained")
+	}
+	if _, found := Interface.netns[netns]; found {
+		t.Error("empty netns retained")
+	}
+}
@@ -0,0 +1,92 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+type ifreqFlags struct {
+	name  [IFNAMSIZ]byte
+	flags uint16
+	_     [22]byte
+}
+
+// Set the administrative state of the interface within its netns then cache
+// the new flags.
+func SetAdmin(ifindex int32, up bool) error {
+	entry := Interface.Indexed(ifindex)
+	if entry == nil {
+		return fmt.Errorf("ifindex %d unknown", ifindex)
+	}
+	var flags uint16
+	set := func() error {
+		fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+		if err != nil {
+			return os.NewSyscallError("socket", err)
+		}
+		defer syscall.Close(fd)
+		var ifr ifreqFlags
+		copy(ifr.name[:IFNAMSIZ-1], entry.Name)
+		if err = ifreqIoctl(fd, syscall.SIOCGIFFLAGS, &ifr); err != nil {
+			return err
+		}
+		if up {
+			ifr.flags |= syscall.IFF_UP
+		} else {
+			ifr.flags &^= syscall.IFF_UP
+		}
+		flags = ifr.flags
+		return ifreqIoctl(fd, syscall.SIOCSIFFLAGS, &ifr)
+	}
+	var err error
+	if entry.Netns == DefaultNetns {
+		err = set()
+	} else {
+		err = entry.Netns.Do(set)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", entry.Name, err)
+	}
+	// keep the driver's flags above the 16 bits of ifr_flags
+	return Interface.set(ifindex,
+		(entry.Flags&^0xffff)|net.Flags(flags))
+}
+
+func ifreqIoctl(fd int, req uintptr, ifr *ifreqFlags) error {
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req,
+		uintptr(unsafe.Pointer(ifr)))
+	if e != 0 {
+		name := "SIOCSIFFLAGS"
+		if req == syscall.SIOCGIFFLAGS {
+			name = "SIOCGIFFLAGS"
+		}
+		return os.NewSyscallError(name, e)
+	}
+	return nil
+}
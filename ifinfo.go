@@ -23,7 +23,38 @@
 
 package xeth
 
-import "net"
+import (
+	"net"
+	"syscall"
+)
+
+// Kernel net_device flags as sent by the driver in MsgIfinfo.Flags; these
+// differ from the net.Flag constants above FlagBroadcast, so Ifinfo.Flags of
+// interfaces cached from net.Interface are translated with ifflagsOf.
+const (
+	IFF_UP      = syscall.IFF_UP
+	IFF_RUNNING = syscall.IFF_RUNNING
+)
+
+// Return the kernel flags of the given net.Interface flags.
+func ifflagsOf(flags net.Flags) net.Flags {
+	var ifflags net.Flags
+	for _, x := range []struct {
+		flag, ifflag net.Flags
+	}{
+		{net.FlagUp, syscall.IFF_UP},
+		{net.FlagBroadcast, syscall.IFF_BROADCAST},
+		{net.FlagLoopback, syscall.IFF_LOOPBACK},
+		{net.FlagPointToPoint, syscall.IFF_POINTOPOINT},
+		{net.FlagMulticast, syscall.IFF_MULTICAST},
+		{net.FlagRunning, syscall.IFF_RUNNING},
+	} {
+		if flags&x.flag == x.flag {
+			ifflags |= x.ifflag
+		}
+	}
+	return ifflags
+}
 
 type Ifinfo struct {
 	Name  string
@@ -42,3 +73,13 @@ type Ifinfo struct {
 func (ifinfo *Ifinfo) HardwareAddr() net.HardwareAddr {
 	return net.HardwareAddr(ifinfo.addr[:])
 }
+
+// Returns true if the interface is administratively up.
+func (ifinfo *Ifinfo) AdminUp() bool {
+	return ifinfo.Flags&IFF_UP == IFF_UP
+}
+
+// Returns true if the interface is up and running.
+func (ifinfo *Ifinfo) OperUp() bool {
+	return ifinfo.AdminUp() && ifinfo.Flags&IFF_RUNNING == IFF_RUNNING
+}
@@ -0,0 +1,322 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// SNMP object identifier
+type OID []uint32
+
+// SNMP value syntax of MibVar.Value
+type MibInteger int32
+type MibGauge32 uint32
+type MibCounter32 uint32
+type MibCounter64 uint64
+type MibOctetString []byte
+
+type MibVar struct {
+	OID   OID
+	Value interface{}
+}
+
+// MibHandler serves the Get and GetNext requests that an AgentX subagent
+// receives from its master agent for the Subtrees that it registers.
+type MibHandler interface {
+	Subtrees() []OID
+	Get(OID) (MibVar, bool)
+	GetNext(OID) (MibVar, bool)
+}
+
+var (
+	OIDifNumber     = OID{1, 3, 6, 1, 2, 1, 2, 1}
+	OIDifEntry      = OID{1, 3, 6, 1, 2, 1, 2, 2, 1}
+	OIDifXEntry     = OID{1, 3, 6, 1, 2, 1, 31, 1, 1, 1}
+	OIDifStackEntry = OID{1, 3, 6, 1, 2, 1, 31, 1, 2, 1}
+)
+
+// IANAifType
+const (
+	IANA_IFTYPE_OTHER           = 1
+	IANA_IFTYPE_ETHERNET_CSMACD = 6
+	IANA_IFTYPE_L2VLAN          = 135
+	IANA_IFTYPE_BRIDGE          = 209
+)
+
+// ifAdminStatus, ifOperStatus, and ifStackStatus
+const (
+	IF_STATUS_UP     = 1
+	IF_STATUS_DOWN   = 2
+	IF_STACK_ACTIVE  = 1
+	IF_STACK_NOLAYER = 0
+)
+
+// IfEntry has the ifTable and ifXTable columns of an interface.
+type IfEntry struct {
+	IfIndex       int32
+	IfDescr       string
+	IfType        int32
+	IfMtu         int32
+	IfSpeed       uint32
+	IfPhysAddress net.HardwareAddr
+	IfAdminStatus int32
+	IfOperStatus  int32
+
+	IfName              string
+	IfHCInOctets        uint64
+	IfHCInUcastPkts     uint64
+	IfHCInMulticastPkts uint64
+	IfHCOutOctets       uint64
+	IfHCOutUcastPkts    uint64
+	IfHighSpeed         uint32
+	IfInErrors          uint64
+	IfOutErrors         uint64
+	IfInDiscards        uint64
+	IfOutDiscards       uint64
+}
+
+// IfStackEntry is a row of ifStackTable; 0 is the missing layer above the
+// highest or below the lowest interface.
+type IfStackEntry struct {
+	Higher, Lower int32
+}
+
+// IfMib is a snapshot of the IF-MIB objects known to xeth.
+type IfMib struct {
+	Entries []IfEntry
+	Stack   []IfStackEntry
+	vars    []MibVar
+}
+
+// Return a snapshot of IF-MIB from the Interface cache and the given
+// link stat Counters, if not nil. The ifMtu is only available for interfaces
+// in the default netns.
+func IfMibOf(counters *Counters) *IfMib {
+	mib := new(IfMib)
+	entries := Interface.snapshot()
+	for i := range entries {
+		entry := &entries[i]
+		mib.Entries = append(mib.Entries, ifEntryOf(entry, counters))
+		if !entry.Uppers.NotEmpty() {
+			mib.Stack = append(mib.Stack,
+				IfStackEntry{IF_STACK_NOLAYER, entry.Index})
+		}
+		for upper := range entry.Uppers {
+			mib.Stack = append(mib.Stack,
+				IfStackEntry{upper, entry.Index})
+		}
+		if !entry.Lowers.NotEmpty() {
+			mib.Stack = append(mib.Stack,
+				IfStackEntry{entry.Index, IF_STACK_NOLAYER})
+		}
+	}
+	mib.index()
+	return mib
+}
+
+func ifEntryOf(entry *InterfaceEntry, counters *Counters) IfEntry {
+	ifentry := IfEntry{
+		IfIndex:       entry.Index,
+		IfDescr:       entry.Name,
+		IfType:        ifTypeOf(entry.DevType),
+		IfPhysAddress: entry.HardwareAddr(),
+		IfAdminStatus: IF_STATUS_DOWN,
+		IfOperStatus:  IF_STATUS_DOWN,
+		IfName:        entry.Name,
+		IfHighSpeed:   uint32(entry.EthtoolSettings.Speed),
+	}
+	if speed := uint64(ifentry.IfHighSpeed) * 1000000; speed > 0xffffffff {
+		ifentry.IfSpeed = 0xffffffff
+	} else {
+		ifentry.IfSpeed = uint32(speed)
+	}
+	if entry.AdminUp() {
+		ifentry.IfAdminStatus = IF_STATUS_UP
+	}
+	if entry.OperUp() {
+		ifentry.IfOperStatus = IF_STATUS_UP
+	}
+	if entry.Netns == DefaultNetns {
+		if p, err := net.InterfaceByIndex(int(entry.Index)); err == nil {
+			ifentry.IfMtu = int32(p.MTU)
+		}
+	}
+	if counters != nil {
+		count := func(index uint64) uint64 {
+			counter, _ := counters.Get(CounterKey{entry.Index,
+				XETH_MSG_KIND_LINK_STAT, index})
+			return counter.Count
+		}
+		ifentry.IfHCInOctets = count(IndexofNetStatRxBytes)
+		ifentry.IfHCInMulticastPkts = count(IndexofNetStatMulticast)
+		ifentry.IfHCInUcastPkts = count(IndexofNetStatRxPackets)
+		if ifentry.IfHCInUcastPkts >= ifentry.IfHCInMulticastPkts {
+			ifentry.IfHCInUcastPkts -= ifentry.IfHCInMulticastPkts
+		}
+		ifentry.IfHCOutOctets = count(IndexofNetStatTxBytes)
+		ifentry.IfHCOutUcastPkts = count(IndexofNetStatTxPackets)
+		ifentry.IfInErrors = count(IndexofNetStatRxErrors)
+		ifentry.IfOutErrors = count(IndexofNetStatTxErrors)
+		ifentry.IfInDiscards = count(IndexofNetStatRxDropped)
+		ifentry.IfOutDiscards = count(IndexofNetStatTxDropped)
+	}
+	return ifentry
+}
+
+func ifTypeOf(devtype DevType) int32 {
+	switch devtype {
+	case XETH_DEVTYPE_XETH_PORT:
+		return IANA_IFTYPE_ETHERNET_CSMACD
+	case XETH_DEVTYPE_LINUX_VLAN, XETH_DEVTYPE_LINUX_VLAN_BRIDGE_PORT:
+		return IANA_IFTYPE_L2VLAN
+	case XETH_DEVTYPE_LINUX_BRIDGE:
+		return IANA_IFTYPE_BRIDGE
+	}
+	return IANA_IFTYPE_OTHER
+}
+
+// Sort the snapshot into lexicographically ordered variables.
+func (mib *IfMib) index() {
+	add := func(oid OID, value interface{}) {
+		mib.vars = append(mib.vars, MibVar{oid, value})
+	}
+	column := func(entry OID, col uint32, ifindex int32) OID {
+		oid := make(OID, 0, len(entry)+2)
+		oid = append(oid, entry...)
+		return append(oid, col, uint32(ifindex))
+	}
+	add(append(OIDifNumber.Clone(), 0), MibInteger(len(mib.Entries)))
+	for _, e := range mib.Entries {
+		add(column(OIDifEntry, 1, e.IfIndex), MibInteger(e.IfIndex))
+		add(column(OIDifEntry, 2, e.IfIndex), MibOctetString(e.IfDescr))
+		add(column(OIDifEntry, 3, e.IfIndex), MibInteger(e.IfType))
+		add(column(OIDifEntry, 4, e.IfIndex), MibInteger(e.IfMtu))
+		add(column(OIDifEntry, 5, e.IfIndex), MibGauge32(e.IfSpeed))
+		add(column(OIDifEntry, 6, e.IfIndex),
+			MibOctetString(e.IfPhysAddress))
+		add(column(OIDifEntry, 7, e.IfIndex),
+			MibInteger(e.IfAdminStatus))
+		add(column(OIDifEntry, 8, e.IfIndex),
+			MibInteger(e.IfOperStatus))
+		add(column(OIDifEntry, 13, e.IfIndex),
+			MibCounter32(e.IfInDiscards))
+		add(column(OIDifEntry, 14, e.IfIndex),
+			MibCounter32(e.IfInErrors))
+		add(column(OIDifEntry, 19, e.IfIndex),
+			MibCounter32(e.IfOutDiscards))
+		add(column(OIDifEntry, 20, e.IfIndex),
+			MibCounter32(e.IfOutErrors))
+		add(column(OIDifXEntry, 1, e.IfIndex), MibOctetString(e.IfName))
+		add(column(OIDifXEntry, 6, e.IfIndex),
+			MibCounter64(e.IfHCInOctets))
+		add(column(OIDifXEntry, 7, e.IfIndex),
+			MibCounter64(e.IfHCInUcastPkts))
+		add(column(OIDifXEntry, 8, e.IfIndex),
+			MibCounter64(e.IfHCInMulticastPkts))
+		add(column(OIDifXEntry, 10, e.IfIndex),
+			MibCounter64(e.IfHCOutOctets))
+		add(column(OIDifXEntry, 11, e.IfIndex),
+			MibCounter64(e.IfHCOutUcastPkts))
+		add(column(OIDifXEntry, 15, e.IfIndex),
+			MibGauge32(e.IfHighSpeed))
+	}
+	for _, s := range mib.Stack {
+		oid := append(OIDifStackEntry.Clone(), 3,
+			uint32(s.Higher), uint32(s.Lower))
+		add(oid, MibInteger(IF_STACK_ACTIVE))
+	}
+	sort.Slice(mib.vars, func(i, j int) bool {
+		return mib.vars[i].OID.Compare(mib.vars[j].OID) < 0
+	})
+}
+
+func (mib *IfMib) Subtrees() []OID {
+	return []OID{OIDifNumber, OIDifEntry, OIDifXEntry, OIDifStackEntry}
+}
+
+// Return the variable of the given instance OID.
+func (mib *IfMib) Get(oid OID) (MibVar, bool) {
+	i := sort.Search(len(mib.vars), func(i int) bool {
+		return mib.vars[i].OID.Compare(oid) >= 0
+	})
+	if i < len(mib.vars) && mib.vars[i].OID.Compare(oid) == 0 {
+		return mib.vars[i], true
+	}
+	return MibVar{}, false
+}
+
+// Return the variable that lexicographically follows the given OID.
+func (mib *IfMib) GetNext(oid OID) (MibVar, bool) {
+	i := sort.Search(len(mib.vars), func(i int) bool {
+		return mib.vars[i].OID.Compare(oid) > 0
+	})
+	if i < len(mib.vars) {
+		return mib.vars[i], true
+	}
+	return MibVar{}, false
+}
+
+func (oid OID) Clone() OID {
+	return append(OID(nil), oid...)
+}
+
+// Return -1, 0, or 1 if oid lexicographically precedes, equals, or follows
+// other.
+func (oid OID) Compare(other OID) int {
+	for i := 0; i < len(oid) && i < len(other); i++ {
+		if oid[i] < other[i] {
+			return -1
+		} else if oid[i] > other[i] {
+			return 1
+		}
+	}
+	switch {
+	case len(oid) < len(other):
+		return -1
+	case len(oid) > len(other):
+		return 1
+	}
+	return 0
+}
+
+// Returns true if oid is within the subtree of prefix.
+func (oid OID) HasPrefix(prefix OID) bool {
+	return len(oid) >= len(prefix) && prefix.Compare(oid[:len(prefix)]) == 0
+}
+
+func (oid OID) String() string {
+	s := make([]string, len(oid))
+	for i, id := range oid {
+		s[i] = fmt.Sprint(id)
+	}
+	return strings.Join(s, ".")
+}
+
+func (v MibVar) String() string {
+	return fmt.Sprint(v.OID, " = ", v.Value)
+}
@@ -0,0 +1,241 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"reflect"
+	"testing"
+)
+
+// agentx stands in for an AgentX master agent that dispatches requests to
+// the subagent handler registered for the subtree.
+type agentx struct {
+	handlers []MibHandler
+}
+
+func (agent *agentx) register(h MibHandler) {
+	agent.handlers = append(agent.handlers, h)
+}
+
+// Return the variables within subtree as snmpwalk would.
+func (agent *agentx) walk(subtree OID) (vars []MibVar) {
+	for _, h := range agent.handlers {
+		for _, registered := range h.Subtrees() {
+			if !subtree.HasPrefix(registered) &&
+				!registered.HasPrefix(subtree) {
+				continue
+			}
+			oid := subtree
+			if registered.HasPrefix(subtree) {
+				oid = registered
+			}
+			for {
+				v, found := h.GetNext(oid)
+				if !found || !v.OID.HasPrefix(subtree) ||
+					!v.OID.HasPrefix(registered) {
+					break
+				}
+				vars = append(vars, v)
+				oid = v.OID
+			}
+		}
+	}
+	return
+}
+
+func TestIfMib(t *testing.T) {
+	mib := &IfMib{
+		Entries: []IfEntry{
+			{
+				IfIndex:       3,
+				IfDescr:       "eth-1-1",
+				IfType:        IANA_IFTYPE_ETHERNET_CSMACD,
+				IfAdminStatus: IF_STATUS_UP,
+				IfOperStatus:  IF_STATUS_DOWN,
+				IfName:        "eth-1-1",
+				IfHCInOctets:  1234,
+				IfHighSpeed:   100000,
+			},
+			{
+				IfIndex:       7,
+				IfDescr:       "eth-1-1.100",
+				IfType:        IANA_IFTYPE_L2VLAN,
+				IfAdminStatus: IF_STATUS_UP,
+				IfOperStatus:  IF_STATUS_UP,
+				IfName:        "eth-1-1.100",
+			},
+		},
+		Stack: []IfStackEntry{
+			{7, 3},
+			{3, IF_STACK_NOLAYER},
+			{IF_STACK_NOLAYER, 7},
+		},
+	}
+	mib.index()
+	agent := new(agentx)
+	agent.register(mib)
+
+	v, found := mib.Get(OID{1, 3, 6, 1, 2, 1, 2, 1, 0})
+	if !found || v.Value != MibInteger(2) {
+		t.Error("ifNumber", v, found)
+	}
+	v, found = mib.Get(OID{1, 3, 6, 1, 2, 1, 31, 1, 1, 1, 6, 3})
+	if !found || v.Value != MibCounter64(1234) {
+		t.Error("ifHCInOctets.3", v, found)
+	}
+	if _, found = mib.Get(OID{1, 3, 6, 1, 2, 1, 2, 2, 1, 1}); found {
+		t.Error("found column without instance")
+	}
+
+	vars := agent.walk(append(OIDifEntry.Clone(), 2))
+	if len(vars) != 2 ||
+		string(vars[0].Value.(MibOctetString)) != "eth-1-1" ||
+		string(vars[1].Value.(MibOctetString)) != "eth-1-1.100" {
+		t.Error("ifDescr", vars)
+	}
+
+	want := []OID{
+		{1, 3, 6, 1, 2, 1, 31, 1, 2, 1, 3, 0, 7},
+		{1, 3, 6, 1, 2, 1, 31, 1, 2, 1, 3, 3, 0},
+		{1, 3, 6, 1, 2, 1, 31, 1, 2, 1, 3, 7, 3},
+	}
+	vars = agent.walk(OIDifStackEntry)
+	if len(vars) != len(want) {
+		t.Fatal("ifStackStatus", vars)
+	}
+	for i, v := range vars {
+		if v.OID.Compare(want[i]) != 0 ||
+			v.Value != MibInteger(IF_STACK_ACTIVE) {
+			t.Error("ifStackStatus", i, v)
+		}
+	}
+
+	vars = agent.walk(OID{1, 3, 6, 1, 2, 1})
+	if n := 1 + 19*len(mib.Entries) + len(mib.Stack); len(vars) != n {
+		t.Error("walk", len(vars), "variables, expected", n)
+	}
+}
+
+// Map interfaces that the driver reports through the cache.
+func TestIfMibOf(t *testing.T) {
+	testCache(t)
+	const port, vlan, bridge = 1010, 1011, 1012
+	ifinfo := func(ifindex int32, name string, devtype DevType,
+		flags uint32) {
+		buf := make([]byte, SizeofMsgIfinfo)
+		msg := ToMsgIfinfo(buf)
+		msg.Kind = XETH_MSG_KIND_IFINFO
+		copy(msg.Ifname[:], name)
+		msg.Net = uint64(DefaultNetns)
+		msg.Ifindex = ifindex
+		msg.Flags = flags
+		msg.Devtype = uint8(devtype)
+		msg.Reason = XETH_IFINFO_REASON_NEW
+		Kind(XETH_MSG_KIND_IFINFO).cache(buf)
+	}
+	changeUpper := func(upper, lower int32, linking uint8) {
+		buf := make([]byte, SizeofMsgChangeUpper)
+		msg := ToMsgChangeUpper(buf)
+		msg.Kind = XETH_MSG_KIND_CHANGE_UPPER
+		msg.Upper, msg.Lower, msg.Linking = upper, lower, linking
+		Kind(XETH_MSG_KIND_CHANGE_UPPER).cache(buf)
+	}
+	del := func(ifindex int32) {
+		Interface.mutex.Lock()
+		defer Interface.mutex.Unlock()
+		Interface.del(ifindex)
+	}
+	defer del(port)
+	defer del(vlan)
+	defer del(bridge)
+	ifinfo(port, "t10", XETH_DEVTYPE_XETH_PORT, IFF_UP|IFF_RUNNING)
+	ifinfo(vlan, "t10.100", XETH_DEVTYPE_LINUX_VLAN, IFF_UP)
+	ifinfo(bridge, "t12", XETH_DEVTYPE_LINUX_BRIDGE, 0)
+	buf := make([]byte, SizeofMsgEthtoolSettings)
+	settings := ToMsgEthtoolSettings(buf)
+	settings.Kind = uint8(XETH_MSG_KIND_ETHTOOL_SETTINGS)
+	settings.Ifindex = port
+	settings.Speed = 100000
+	Kind(XETH_MSG_KIND_ETHTOOL_SETTINGS).cache(buf)
+	changeUpper(vlan, port, 1)
+	changeUpper(bridge, vlan, 1)
+	changeUpper(bridge, vlan, 0)
+
+	mib := IfMibOf(nil)
+	entries := make(map[int32]IfEntry)
+	for _, e := range mib.Entries {
+		entries[e.IfIndex] = e
+	}
+	for _, want := range []IfEntry{
+		{
+			IfIndex:       port,
+			IfDescr:       "t10",
+			IfType:        IANA_IFTYPE_ETHERNET_CSMACD,
+			IfSpeed:       0xffffffff,
+			IfAdminStatus: IF_STATUS_UP,
+			IfOperStatus:  IF_STATUS_UP,
+			IfName:        "t10",
+			IfHighSpeed:   100000,
+		},
+		{
+			IfIndex:       vlan,
+			IfDescr:       "t10.100",
+			IfType:        IANA_IFTYPE_L2VLAN,
+			IfAdminStatus: IF_STATUS_UP,
+			IfOperStatus:  IF_STATUS_DOWN,
+			IfName:        "t10.100",
+		},
+		{
+			IfIndex:       bridge,
+			IfDescr:       "t12",
+			IfType:        IANA_IFTYPE_BRIDGE,
+			IfAdminStatus: IF_STATUS_DOWN,
+			IfOperStatus:  IF_STATUS_DOWN,
+			IfName:        "t12",
+		},
+	} {
+		got := entries[want.IfIndex]
+		got.IfPhysAddress = nil
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%+v\nexpected %+v", got, want)
+		}
+	}
+	stack := make(map[IfStackEntry]bool)
+	for _, s := range mib.Stack {
+		if s.Higher >= port || s.Lower >= port {
+			stack[s] = true
+		}
+	}
+	// the unlinked bridge is at the top and bottom of its own stack
+	want := map[IfStackEntry]bool{
+		{IF_STACK_NOLAYER, vlan}:   true,
+		{vlan, port}:               true,
+		{port, IF_STACK_NOLAYER}:   true,
+		{IF_STACK_NOLAYER, bridge}: true,
+		{bridge, IF_STACK_NOLAYER}: true,
+	}
+	if !reflect.DeepEqual(stack, want) {
+		t.Error("stack", stack)
+	}
+}
@@ -0,0 +1,72 @@
+//go:build ignore
+// +build ignore
+
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+// Input to cgo -godefs for the driver messages that aren't in godefed.go.
+// The C structs declare the layout that the library expects of the driver's
+// struct xeth_msg_ifdel and struct xeth_msg_ifvid; keep them in step with the
+// driver's header, then regenerate with
+//
+//	go tool cgo -godefs ifmsgs_godefs.go | gofmt > ifmsgs_godefed.go
+
+package xeth
+
+/*
+#include <linux/types.h>
+
+#define XETH_MSG_HEADER	\
+	__u64 z64;	\
+	__u32 z32;	\
+	__u16 z16;	\
+	__u8 z8;	\
+	__u8 kind
+
+struct xeth_msg_ifdel {
+	XETH_MSG_HEADER;
+	__s32 ifindex;
+	__u8 devtype;
+	__u8 pad[3];
+};
+
+struct xeth_msg_ifvid {
+	XETH_MSG_HEADER;
+	__s32 ifindex;
+	__u8 op;
+	__u8 pad;
+	__u16 vid;
+};
+*/
+import "C"
+
+const (
+	SizeofMsgIfdel = C.sizeof_struct_xeth_msg_ifdel
+	SizeofMsgIfvid = C.sizeof_struct_xeth_msg_ifvid
+)
+
+// Driver notice that it deleted the given interface.
+type MsgIfdel C.struct_xeth_msg_ifdel
+
+// Driver notice that it added or deleted a vlan id of the given interface.
+type MsgIfvid C.struct_xeth_msg_ifvid
@@ -23,6 +23,7 @@
 package xeth
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	"unsafe"
@@ -45,6 +46,10 @@ const (
 	XETH_MSG_KIND_NEIGH_UPDATE
 	XETH_MSG_KIND_IFVID
 	XETH_MSG_KIND_CHANGE_UPPER
+	XETH_MSG_KIND_STATS
+	XETH_MSG_KIND_ACK
+	XETH_MSG_KIND_NAK
+	XETH_MSG_KIND_HELLO
 )
 
 const XETH_MSG_KIND_NOT_MSG = 0xff
@@ -58,11 +63,15 @@ func ToMsg(buf []byte) *Msg {
 func KindOf(buf []byte) Kind {
 	var kind Kind = XETH_MSG_KIND_NOT_MSG
 	msg := ToMsg(buf)
-	if len(buf) >= SizeofMsg &&
-		msg.Z64 == 0 &&
-		msg.Z32 == 0 &&
-		msg.Z16 == 0 &&
-		msg.Z8 == 0 {
+	if len(buf) < SizeofMsg || msg.Z64 != 0 || msg.Z8 != 0 {
+		return kind
+	}
+	switch msg.Z16 {
+	case XETH_MSG_HEADER_V1:
+		if msg.Z32 == 0 {
+			kind = Kind(msg.Kind)
+		}
+	case XETH_MSG_HEADER_SEQ:
 		kind = Kind(msg.Kind)
 	}
 	return kind
@@ -86,6 +95,10 @@ func (kind Kind) String() string {
 		"neigh-update",
 		"ifvid",
 		"change-upper",
+		"stats",
+		"ack",
+		"nak",
+		"hello",
 	}
 	i := int(kind)
 	if kind == XETH_MSG_KIND_NOT_MSG {
@@ -97,6 +110,8 @@ func (kind Kind) String() string {
 }
 
 func (kind Kind) cache(buf []byte) {
+	Interface.mutex.Lock()
+	defer Interface.mutex.Unlock()
 	switch kind {
 	case XETH_MSG_KIND_CHANGE_UPPER:
 		msg := ToMsgChangeUpper(buf)
@@ -120,14 +135,14 @@ func (kind Kind) cache(buf []byte) {
 		case XETH_IFINFO_REASON_REG:
 			entry, found := Interface.index[msg.Ifindex]
 			if found {
-				entry.Netns = Netns(msg.Net)
+				entry.cache(Netns(msg.Net))
 			} else {
 				Interface.cache(msg.Ifindex, msg)
 			}
 		case XETH_IFINFO_REASON_UNREG:
 			entry, found := Interface.index[msg.Ifindex]
 			if found {
-				entry.Netns = DefaultNetns
+				entry.cache(DefaultNetns)
 			}
 		}
 	case XETH_MSG_KIND_ETHTOOL_FLAGS:
@@ -139,24 +154,156 @@ func (kind Kind) cache(buf []byte) {
 	}
 }
 
+// ValidationError describes a received message that Kind.validate rejects.
+type ValidationError struct {
+	Kind
+	Len    int
+	Reason string
+}
+
+func (err *ValidationError) Error() string {
+	return fmt.Sprint("invalid ", err.Kind, " of ", err.Len, " bytes: ",
+		err.Reason)
+}
+
+// Return the exact size of fixed length kinds.
+func (kind Kind) size() (int, bool) {
+	n, found := map[Kind]int{
+		XETH_MSG_KIND_BREAK:         SizeofMsgBreak,
+		XETH_MSG_KIND_LINK_STAT:     SizeofMsgStat,
+		XETH_MSG_KIND_ETHTOOL_STAT:  SizeofMsgStat,
+		XETH_MSG_KIND_ETHTOOL_FLAGS: SizeofMsgEthtoolFlags,
+		XETH_MSG_KIND_DUMP_IFINFO:   SizeofMsgDumpIfinfo,
+		XETH_MSG_KIND_CARRIER:       SizeofMsgCarrier,
+		XETH_MSG_KIND_SPEED:         SizeofMsgSpeed,
+		XETH_MSG_KIND_IFINFO:        SizeofMsgIfinfo,
+		XETH_MSG_KIND_IFA:           SizeofMsgIfa,
+		XETH_MSG_KIND_DUMP_FIBINFO:  SizeofMsgDumpFibinfo,
+		XETH_MSG_KIND_NEIGH_UPDATE:  SizeofMsgNeighUpdate,
+		XETH_MSG_KIND_CHANGE_UPPER:  SizeofMsgChangeUpper,
+		XETH_MSG_KIND_ACK:           SizeofMsgAck,
+		XETH_MSG_KIND_NAK:           SizeofMsgAck,
+		XETH_MSG_KIND_HELLO:         SizeofMsgHello,
+		XETH_MSG_KIND_IFDEL:         SizeofMsgIfdel,
+		XETH_MSG_KIND_IFVID:         SizeofMsgIfvid,
+	}[kind]
+	return n, found
+}
+
+// Return the minimum size of variable length kinds.
+func (kind Kind) minSize() (int, bool) {
+	n, found := map[Kind]int{
+		XETH_MSG_KIND_ETHTOOL_SETTINGS: offsetofLinkModeMasks,
+		XETH_MSG_KIND_FIBENTRY:         SizeofMsgFibentry,
+		XETH_MSG_KIND_STATS:            SizeofMsgStats,
+	}[kind]
+	return n, found
+}
+
+// Returns a *ValidationError if the message is unknown, has the wrong size for
+// its kind, or has a field out of range. Kinds that the driver doesn't
+// support are still validated by size since the driver sent them.
 func (kind Kind) validate(buf []byte) error {
+	invalid := func(format string, args ...interface{}) error {
+		return &ValidationError{kind, len(buf),
+			fmt.Sprintf(format, args...)}
+	}
 	if kind == XETH_MSG_KIND_NOT_MSG {
-		return fmt.Errorf("corrupt message")
+		return invalid("corrupt header")
 	}
-	n, found := map[Kind]int{
-		XETH_MSG_KIND_CHANGE_UPPER:     SizeofMsgChangeUpper,
-		XETH_MSG_KIND_ETHTOOL_FLAGS:    SizeofMsgEthtoolFlags,
-		XETH_MSG_KIND_ETHTOOL_SETTINGS: SizeofMsgEthtoolSettings,
-		XETH_MSG_KIND_IFA:              SizeofMsgIfa,
-		XETH_MSG_KIND_IFINFO:           SizeofMsgIfinfo,
-		XETH_MSG_KIND_NEIGH_UPDATE:     SizeofMsgNeighUpdate,
-	}[kind]
-	if found && n != len(buf) {
-		return fmt.Errorf("mismatched %s", kind)
+	if n, found := kind.size(); found {
+		if len(buf) != n {
+			return invalid("expected %d bytes", n)
+		}
+	} else if n, found := kind.minSize(); found {
+		if len(buf) < n {
+			return invalid("expected at least %d bytes", n)
+		}
+	} else {
+		return invalid("unknown kind")
+	}
+	switch kind {
+	case XETH_MSG_KIND_CARRIER:
+		msg := ToMsgCarrier(buf)
+		if msg.Flag > XETH_CARRIER_ON {
+			return invalid("carrier flag %d", msg.Flag)
+		}
+	case XETH_MSG_KIND_ETHTOOL_SETTINGS:
+		msg := ToMsgEthtoolSettings(buf)
+		n := SizeofMsgEthtoolSettingsNwords(msg.Nwords())
+		if len(buf) != n {
+			return invalid("expected %d bytes with %d word masks",
+				n, msg.Nwords())
+		}
+	case XETH_MSG_KIND_FIBENTRY:
+		msg := ToMsgFibentry(buf)
+		n := SizeofMsgFibentry + (int(msg.Nhs) * SizeofNextHop)
+		if len(buf) != n {
+			return invalid("expected %d bytes with %d next hops",
+				n, msg.Nhs)
+		}
+		if msg.Event > FIB_EVENT_ENTRY_DEL {
+			return invalid("event %d", msg.Event)
+		}
+	case XETH_MSG_KIND_IFA:
+		msg := ToMsgIfa(buf)
+		if msg.Event < NETDEV_UP ||
+			msg.Event > NETDEV_CHANGE_TX_QUEUE_LEN {
+			return invalid("event %d", msg.Event)
+		}
+	case XETH_MSG_KIND_IFDEL:
+		msg := ToMsgIfdel(buf)
+		if msg.Ifindex <= 0 {
+			return invalid("ifindex %d", msg.Ifindex)
+		}
+		if !validDevtype(msg.Devtype) {
+			return invalid("devtype %d", msg.Devtype)
+		}
+	case XETH_MSG_KIND_IFINFO:
+		msg := ToMsgIfinfo(buf)
+		if msg.Reason > XETH_IFINFO_REASON_VLAN_DUMP {
+			return invalid("reason %d", msg.Reason)
+		}
+		if !validDevtype(msg.Devtype) {
+			return invalid("devtype %d", msg.Devtype)
+		}
+		if bytes.IndexByte(msg.Ifname[:], 0) < 0 {
+			return invalid("unterminated ifname")
+		}
+	case XETH_MSG_KIND_IFVID:
+		msg := ToMsgIfvid(buf)
+		if msg.Ifindex <= 0 {
+			return invalid("ifindex %d", msg.Ifindex)
+		}
+		if msg.Op > XETH_IFVID_DEL {
+			return invalid("op %d", msg.Op)
+		}
+		if msg.Vid == 0 || msg.Vid >= 4095 {
+			return invalid("vid %d", msg.Vid)
+		}
+	case XETH_MSG_KIND_STATS:
+		msg := ToMsgStats(buf)
+		n := SizeofMsgStats + (int(msg.N) * SizeofMsgStatsEntry)
+		if len(buf) != n {
+			return invalid("expected %d bytes with %d entries",
+				n, msg.N)
+		}
 	}
 	return nil
 }
 
+func validDevtype(devtype uint8) bool {
+	switch devtype {
+	case XETH_DEVTYPE_XETH_PORT,
+		XETH_DEVTYPE_LINUX_UNKNOWN,
+		XETH_DEVTYPE_LINUX_VLAN,
+		XETH_DEVTYPE_LINUX_VLAN_BRIDGE_PORT,
+		XETH_DEVTYPE_LINUX_BRIDGE:
+		return true
+	}
+	return false
+}
+
 func ToMsgCarrier(buf []byte) *MsgCarrier {
 	return (*MsgCarrier)(unsafe.Pointer(&buf[0]))
 }
@@ -173,6 +320,10 @@ func ToMsgEthtoolSettings(buf []byte) *MsgEthtoolSettings {
 	return (*MsgEthtoolSettings)(unsafe.Pointer(&buf[0]))
 }
 
+func ToMsgFibentry(buf []byte) *MsgFibentry {
+	return (*MsgFibentry)(unsafe.Pointer(&buf[0]))
+}
+
 func ToMsgIfa(buf []byte) *MsgIfa {
 	return (*MsgIfa)(unsafe.Pointer(&buf[0]))
 }
@@ -0,0 +1,146 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestValidate(t *testing.T) {
+	// the generated types have the sizeof their C structs
+	if unsafe.Sizeof(MsgIfdel{}) != SizeofMsgIfdel ||
+		unsafe.Sizeof(MsgIfvid{}) != SizeofMsgIfvid {
+		t.Fatal("ifdel or ifvid size")
+	}
+	ifinfo := func(f func(*MsgIfinfo)) []byte {
+		buf := make([]byte, SizeofMsgIfinfo)
+		msg := ToMsgIfinfo(buf)
+		msg.Kind = XETH_MSG_KIND_IFINFO
+		copy(msg.Ifname[:], "eth-1-1")
+		msg.Reason = XETH_IFINFO_REASON_DUMP
+		if f != nil {
+			f(msg)
+		}
+		return buf
+	}
+	fibentry := func(nhs, extra int) []byte {
+		buf := make([]byte, SizeofMsgFibentry+
+			((nhs+extra)*SizeofNextHop))
+		msg := ToMsgFibentry(buf)
+		msg.Kind = XETH_MSG_KIND_FIBENTRY
+		msg.Nhs = uint8(nhs)
+		return buf
+	}
+	stats := func(n, extra int) []byte {
+		buf := make([]byte, SizeofMsgStats+
+			((n+extra)*SizeofMsgStatsEntry))
+		msg := ToMsgStats(buf)
+		msg.Kind = uint8(XETH_MSG_KIND_STATS)
+		msg.N = uint32(n)
+		return buf
+	}
+	ifdel := func(ifindex int32, devtype uint8) []byte {
+		buf := make([]byte, SizeofMsgIfdel)
+		msg := ToMsgIfdel(buf)
+		msg.Kind = XETH_MSG_KIND_IFDEL
+		msg.Ifindex = ifindex
+		msg.Devtype = devtype
+		return buf
+	}
+	ifvid := func(op uint8, vid uint16) []byte {
+		buf := make([]byte, SizeofMsgIfvid)
+		msg := ToMsgIfvid(buf)
+		msg.Kind = XETH_MSG_KIND_IFVID
+		msg.Ifindex = 3
+		msg.Op = op
+		msg.Vid = vid
+		return buf
+	}
+	kind := func(k Kind, n int) []byte {
+		buf := make([]byte, n)
+		ToMsg(buf).Kind = uint8(k)
+		return buf
+	}
+	for _, tc := range []struct {
+		name  string
+		buf   []byte
+		valid bool
+	}{
+		{"ifinfo", ifinfo(nil), true},
+		{"short ifinfo", ifinfo(nil)[:SizeofMsgIfinfo-8], false},
+		{"ifinfo reason", ifinfo(func(msg *MsgIfinfo) {
+			msg.Reason = XETH_IFINFO_REASON_VLAN_DUMP + 1
+		}), false},
+		{"ifinfo devtype", ifinfo(func(msg *MsgIfinfo) {
+			msg.Devtype = 7
+		}), false},
+		{"ifinfo name", ifinfo(func(msg *MsgIfinfo) {
+			copy(msg.Ifname[:], "0123456789abcdef")
+		}), false},
+		{"fibentry", fibentry(2, 0), true},
+		{"fibentry overrun", fibentry(2, -1), false},
+		{"fibentry trailer", fibentry(0, 1), false},
+		{"stats", stats(3, 0), true},
+		{"empty stats", stats(0, 0), true},
+		{"stats overrun", stats(3, -1), false},
+		{"stats trailer", stats(1, 1), false},
+		{"break", kind(XETH_MSG_KIND_BREAK, SizeofMsgBreak), true},
+		{"carrier", kind(XETH_MSG_KIND_CARRIER, SizeofMsgCarrier), true},
+		{"short speed", kind(XETH_MSG_KIND_SPEED, SizeofMsg), false},
+		{"stat", kind(XETH_MSG_KIND_LINK_STAT, SizeofMsgStat), true},
+		{"ifdel", ifdel(3, XETH_DEVTYPE_LINUX_VLAN), true},
+		{"short ifdel", ifdel(3, 0)[:SizeofMsg+4], false},
+		{"ifdel ifindex", ifdel(0, 0), false},
+		{"ifdel devtype", ifdel(3, 7), false},
+		{"ifvid", ifvid(XETH_IFVID_DEL, 4094), true},
+		{"long ifvid", append(ifvid(XETH_IFVID_ADD, 1), 0), false},
+		{"ifvid op", ifvid(XETH_IFVID_DEL+1, 1), false},
+		{"ifvid zero", ifvid(XETH_IFVID_ADD, 0), false},
+		{"ifvid range", ifvid(XETH_IFVID_ADD, 4095), false},
+		{"ifa event", kind(XETH_MSG_KIND_IFA, SizeofMsgIfa), false},
+		{"unknown", kind(XETH_MSG_KIND_HELLO+1, SizeofMsg), false},
+		{"corrupt", make([]byte, 4), false},
+	} {
+		var k Kind = XETH_MSG_KIND_NOT_MSG
+		if len(tc.buf) >= SizeofMsg {
+			k = KindOf(tc.buf)
+		}
+		err := k.validate(tc.buf)
+		if tc.valid && err != nil {
+			t.Error(tc.name, err)
+		} else if !tc.valid {
+			if _, ok := err.(*ValidationError); !ok {
+				t.Error(tc.name, "validated")
+			}
+		}
+	}
+	// received kinds needn't be supported
+	saved := xeth.driver
+	defer func() { xeth.driver = saved }()
+	legacy()
+	if err := Kind(XETH_MSG_KIND_STATS).validate(stats(1, 0)); err != nil {
+		t.Error("legacy", err)
+	}
+}
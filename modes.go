@@ -25,6 +25,8 @@ package xeth
 import (
 	"bytes"
 	"fmt"
+	"strings"
+	"unicode"
 )
 
 const (
@@ -77,80 +79,399 @@ const (
 	ETHTOOL_LINK_MODE_10000baseER_Full
 	ETHTOOL_LINK_MODE_2500baseT_Full
 	ETHTOOL_LINK_MODE_5000baseT_Full
+	ETHTOOL_LINK_MODE_FEC_NONE
+	ETHTOOL_LINK_MODE_FEC_RS
+	ETHTOOL_LINK_MODE_FEC_BASER
+	ETHTOOL_LINK_MODE_50000baseKR_Full
+	ETHTOOL_LINK_MODE_50000baseSR_Full
+	ETHTOOL_LINK_MODE_50000baseCR_Full
+	ETHTOOL_LINK_MODE_50000baseLR_ER_FR_Full
+	ETHTOOL_LINK_MODE_50000baseDR_Full
+	ETHTOOL_LINK_MODE_100000baseKR2_Full
+	ETHTOOL_LINK_MODE_100000baseSR2_Full
+	ETHTOOL_LINK_MODE_100000baseCR2_Full
+	ETHTOOL_LINK_MODE_100000baseLR2_ER2_FR2_Full
+	ETHTOOL_LINK_MODE_100000baseDR2_Full
+	ETHTOOL_LINK_MODE_200000baseKR4_Full
+	ETHTOOL_LINK_MODE_200000baseSR4_Full
+	ETHTOOL_LINK_MODE_200000baseLR4_ER4_FR4_Full
+	ETHTOOL_LINK_MODE_200000baseDR4_Full
+	ETHTOOL_LINK_MODE_200000baseCR4_Full
+	ETHTOOL_LINK_MODE_100baseT1_Full
+	ETHTOOL_LINK_MODE_1000baseT1_Full
+	ETHTOOL_LINK_MODE_400000baseKR8_Full
+	ETHTOOL_LINK_MODE_400000baseSR8_Full
+	ETHTOOL_LINK_MODE_400000baseLR8_ER8_FR8_Full
+	ETHTOOL_LINK_MODE_400000baseDR8_Full
+	ETHTOOL_LINK_MODE_400000baseCR8_Full
+	ETHTOOL_LINK_MODE_FEC_LLRS
+	ETHTOOL_LINK_MODE_100000baseKR_Full
+	ETHTOOL_LINK_MODE_100000baseSR_Full
+	ETHTOOL_LINK_MODE_100000baseLR_ER_FR_Full
+	ETHTOOL_LINK_MODE_100000baseCR_Full
+	ETHTOOL_LINK_MODE_100000baseDR_Full
+	ETHTOOL_LINK_MODE_200000baseKR2_Full
+	ETHTOOL_LINK_MODE_200000baseSR2_Full
+	ETHTOOL_LINK_MODE_200000baseLR2_ER2_FR2_Full
+	ETHTOOL_LINK_MODE_200000baseDR2_Full
+	ETHTOOL_LINK_MODE_200000baseCR2_Full
+	ETHTOOL_LINK_MODE_400000baseKR4_Full
+	ETHTOOL_LINK_MODE_400000baseSR4_Full
+	ETHTOOL_LINK_MODE_400000baseLR4_ER4_FR4_Full
+	ETHTOOL_LINK_MODE_400000baseDR4_Full
+	ETHTOOL_LINK_MODE_400000baseCR4_Full
+	ETHTOOL_LINK_MODE_100baseFX_Half
+	ETHTOOL_LINK_MODE_100baseFX_Full
+	ETHTOOL_LINK_MODE_10baseT1L_Full
+	ETHTOOL_LINK_MODE_800000baseCR8_Full
+	ETHTOOL_LINK_MODE_800000baseKR8_Full
+	ETHTOOL_LINK_MODE_800000baseDR8_Full
+	ETHTOOL_LINK_MODE_800000baseDR8_2_Full
+	ETHTOOL_LINK_MODE_800000baseSR8_Full
+	ETHTOOL_LINK_MODE_800000baseVR8_Full
+	ETHTOOL_LINK_MODE_10baseT1S_Full
+	ETHTOOL_LINK_MODE_10baseT1S_Half
+	ETHTOOL_LINK_MODE_10baseT1S_P2MP_Half
+	ETHTOOL_LINK_MODE_10baseT1BRR_Full
+	ETHTOOL_LINK_MODE_200000baseCR_Full
+	ETHTOOL_LINK_MODE_200000baseKR_Full
+	ETHTOOL_LINK_MODE_200000baseDR_Full
+	ETHTOOL_LINK_MODE_200000baseDR_2_Full
+	ETHTOOL_LINK_MODE_200000baseSR_Full
+	ETHTOOL_LINK_MODE_200000baseVR_Full
+	ETHTOOL_LINK_MODE_400000baseCR2_Full
+	ETHTOOL_LINK_MODE_400000baseKR2_Full
+	ETHTOOL_LINK_MODE_400000baseDR2_Full
+	ETHTOOL_LINK_MODE_400000baseDR2_2_Full
+	ETHTOOL_LINK_MODE_400000baseSR2_Full
+	ETHTOOL_LINK_MODE_400000baseVR2_Full
+	ETHTOOL_LINK_MODE_800000baseCR4_Full
+	ETHTOOL_LINK_MODE_800000baseKR4_Full
+	ETHTOOL_LINK_MODE_800000baseDR4_Full
+	ETHTOOL_LINK_MODE_800000baseDR4_2_Full
+	ETHTOOL_LINK_MODE_800000baseSR4_Full
+	ETHTOOL_LINK_MODE_800000baseVR4_Full
 	ETHTOOL_LINK_MODE_NBITS
 )
 
 const ETHTOOL_LINK_MODE_NWORDS = (((ETHTOOL_LINK_MODE_NBITS) + 32) - 1) / 32
 
+type EthtoolLinkMode uint
+
 type EthtoolLinkModeBits [ETHTOOL_LINK_MODE_NWORDS]uint32
 
+// Map of hyphenated EthtoolLinkModes, built before any concurrent lookup.
+var EthtoolLinkModeMap map[string]EthtoolLinkMode
+
+func init() {
+	EthtoolLinkModeMap = make(map[string]EthtoolLinkMode)
+	for i, s := range EthtoolLinkModes {
+		EthtoolLinkModeMap[Hyphenate(s)] = EthtoolLinkMode(i)
+	}
+}
+
+var EthtoolLinkModes = []string{
+	"10baseT/Half",
+	"10baseT/Full",
+	"100baseT/Half",
+	"100baseT/Full",
+	"1000baseT/Half",
+	"1000baseT/Full",
+	"Autoneg",
+	"TP",
+	"AUI",
+	"MII",
+	"FIBRE",
+	"BNC",
+	"10000baseT/Full",
+	"Pause",
+	"Asym-Pause",
+	"2500baseX/Full",
+	"Backplane",
+	"1000baseKX/Full",
+	"10000baseKX4/Full",
+	"10000baseKR/Full",
+	"10000baseR_FEC",
+	"20000baseMLD2/Full",
+	"20000baseKR2/Full",
+	"40000baseKR4/Full",
+	"40000baseCR4/Full",
+	"40000baseSR4/Full",
+	"40000baseLR4/Full",
+	"56000baseKR4/Full",
+	"56000baseCR4/Full",
+	"56000baseSR4/Full",
+	"56000baseLR4/Full",
+	"25000baseCR/Full",
+	"25000baseKR/Full",
+	"25000baseSR/Full",
+	"50000baseCR2/Full",
+	"50000baseKR2/Full",
+	"100000baseKR4/Full",
+	"100000baseSR4/Full",
+	"100000baseCR4/Full",
+	"100000baseLR4_ER4/Full",
+	"50000baseSR2/Full",
+	"1000baseX/Full",
+	"10000baseCR/Full",
+	"10000baseSR/Full",
+	"10000baseLR/Full",
+	"10000baseLRM/Full",
+	"10000baseER/Full",
+	"2500baseT/Full",
+	"5000baseT/Full",
+	"None",
+	"RS",
+	"BASER",
+	"50000baseKR/Full",
+	"50000baseSR/Full",
+	"50000baseCR/Full",
+	"50000baseLR_ER_FR/Full",
+	"50000baseDR/Full",
+	"100000baseKR2/Full",
+	"100000baseSR2/Full",
+	"100000baseCR2/Full",
+	"100000baseLR2_ER2_FR2/Full",
+	"100000baseDR2/Full",
+	"200000baseKR4/Full",
+	"200000baseSR4/Full",
+	"200000baseLR4_ER4_FR4/Full",
+	"200000baseDR4/Full",
+	"200000baseCR4/Full",
+	"100baseT1/Full",
+	"1000baseT1/Full",
+	"400000baseKR8/Full",
+	"400000baseSR8/Full",
+	"400000baseLR8_ER8_FR8/Full",
+	"400000baseDR8/Full",
+	"400000baseCR8/Full",
+	"LLRS",
+	"100000baseKR/Full",
+	"100000baseSR/Full",
+	"100000baseLR_ER_FR/Full",
+	"100000baseCR/Full",
+	"100000baseDR/Full",
+	"200000baseKR2/Full",
+	"200000baseSR2/Full",
+	"200000baseLR2_ER2_FR2/Full",
+	"200000baseDR2/Full",
+	"200000baseCR2/Full",
+	"400000baseKR4/Full",
+	"400000baseSR4/Full",
+	"400000baseLR4_ER4_FR4/Full",
+	"400000baseDR4/Full",
+	"400000baseCR4/Full",
+	"100baseFX/Half",
+	"100baseFX/Full",
+	"10baseT1L/Full",
+	"800000baseCR8/Full",
+	"800000baseKR8/Full",
+	"800000baseDR8/Full",
+	"800000baseDR8_2/Full",
+	"800000baseSR8/Full",
+	"800000baseVR8/Full",
+	"10baseT1S/Full",
+	"10baseT1S/Half",
+	"10baseT1S_P2MP/Half",
+	"10baseT1BRR/Full",
+	"200000baseCR/Full",
+	"200000baseKR/Full",
+	"200000baseDR/Full",
+	"200000baseDR_2/Full",
+	"200000baseSR/Full",
+	"200000baseVR/Full",
+	"400000baseCR2/Full",
+	"400000baseKR2/Full",
+	"400000baseDR2/Full",
+	"400000baseDR2_2/Full",
+	"400000baseSR2/Full",
+	"400000baseVR2/Full",
+	"800000baseCR4/Full",
+	"800000baseKR4/Full",
+	"800000baseDR4/Full",
+	"800000baseDR4_2/Full",
+	"800000baseSR4/Full",
+	"800000baseVR4/Full",
+}
+
+// Return link mode of the given ethtool name, e.g. "25000baseCR/Full".
+func EthtoolLinkModeOf(s string) (EthtoolLinkMode, bool) {
+	mode, found := EthtoolLinkModeMap[Hyphenate(s)]
+	return mode, found
+}
+
+// Return the highest speed of the modes advertised by both link partners.
+func HighestCommonSpeed(advertising *Advertising, partner *Partner) Mbps {
+	var common EthtoolLinkModeBits
+	common.Load((*EthtoolLinkModeBits)(advertising))
+	common.Intersection((*EthtoolLinkModeBits)(partner))
+	return common.HighestSpeed()
+}
+
+func (mode EthtoolLinkMode) String() string {
+	s := "invalid"
+	if i := int(mode); i < len(EthtoolLinkModes) {
+		s = EthtoolLinkModes[i]
+	}
+	return s
+}
+
+// Return the speed of a "<Mbps>base.../<Duplex>" mode or 0 for others like
+// "Autoneg" and "10000baseR_FEC".
+func (mode EthtoolLinkMode) Speed() Mbps {
+	var mbps Mbps
+	s := mode.String()
+	i := strings.Index(s, "base")
+	if i <= 0 || !strings.Contains(s[i:], "/") {
+		return 0
+	}
+	for _, c := range s[:i] {
+		if c < '0' || c > '9' {
+			return 0
+		}
+		mbps = (mbps * 10) + Mbps(c-'0')
+	}
+	return mbps
+}
+
+// Return the number of serdes lanes of a "<Mbps>base<Media><Lanes>..." mode,
+// e.g. 4 for "100000baseCR4/Full", 1 for "25000baseCR/Full", or 0 for modes
+// without speed.
+func (mode EthtoolLinkMode) Lanes() int {
+	if mode.Speed() == 0 {
+		return 0
+	}
+	s := mode.String()
+	s = s[strings.Index(s, "base")+len("base"):]
+	if i := strings.IndexAny(s, "_/"); i >= 0 {
+		s = s[:i]
+	}
+	i := len(s)
+	for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+		i--
+	}
+	lanes := 0
+	for _, c := range s[i:] {
+		lanes = (lanes * 10) + int(c-'0')
+	}
+	if lanes == 0 {
+		return 1
+	}
+	return lanes
+}
+
+// Return the duplex of a "<Mbps>base.../<Duplex>" mode.
+func (mode EthtoolLinkMode) Duplex() Duplex {
+	if strings.HasSuffix(mode.String(), "/Half") {
+		return DUPLEX_HALF
+	}
+	return DUPLEX_FULL
+}
+
 func (bits *EthtoolLinkModeBits) Load(from *EthtoolLinkModeBits) {
 	copy(bits[:], from[:])
 }
 
+// Parse ethtool mode names separated by space, comma, or '|' then set their
+// bits.
+func (bits *EthtoolLinkModeBits) Parse(s string) error {
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '|' || unicode.IsSpace(r)
+	}) {
+		mode, found := EthtoolLinkModeOf(name)
+		if !found {
+			return fmt.Errorf("%q unknown", name)
+		}
+		bits.Set(uint(mode))
+	}
+	return nil
+}
+
+// Set, Clear, and Test ignore bits beyond ETHTOOL_LINK_MODE_NBITS.
 func (bits *EthtoolLinkModeBits) Set(n uint) {
-	bits[n/32] |= (1 << n)
+	if n < ETHTOOL_LINK_MODE_NBITS {
+		bits[n/32] |= 1 << (n % 32)
+	}
 }
 
-func (bits *EthtoolLinkModeBits) String() string {
-	buf := new(bytes.Buffer)
-	none := true
-	for i, s := range []string{
-		"10baseT/Half",
-		"10baseT/Full",
-		"100baseT/Half",
-		"100baseT/Full",
-		"1000baseT/Half",
-		"1000baseT/Full",
-		"Autoneg",
-		"TP",
-		"AUI",
-		"MII",
-		"FIBRE",
-		"BNC",
-		"10000baseT/Full",
-		"Pause",
-		"Asym-Pause",
-		"2500baseX/Full",
-		"Backplane",
-		"1000baseKX/Full",
-		"10000baseKX4/Full",
-		"10000baseKR/Full",
-		"10000baseR_FEC",
-		"20000baseMLD2/Full",
-		"20000baseKR2/Full",
-		"40000baseKR4/Full",
-		"40000baseCR4/Full",
-		"40000baseSR4/Full",
-		"40000baseLR4/Full",
-		"56000baseKR4/Full",
-		"56000baseCR4/Full",
-		"56000baseSR4/Full",
-		"56000baseLR4/Full",
-		"25000baseCR/Full",
-		"25000baseKR/Full",
-		"25000baseSR/Full",
-		"50000baseCR2/Full",
-		"50000baseKR2/Full",
-		"100000baseKR4/Full",
-		"100000baseSR4/Full",
-		"100000baseCR4/Full",
-		"100000baseLR4 ER4/Full",
-		"50000baseSR2/Full",
-		"1000baseX/Full",
-		"10000baseCR/Full",
-		"10000baseSR/Full",
-		"10000baseLR/Full",
-		"10000baseLRM/Full",
-		"10000baseER/Full",
-		"2500baseT/Full",
-		"5000baseT/Full",
-	} {
+func (bits *EthtoolLinkModeBits) Clear(n uint) {
+	if n < ETHTOOL_LINK_MODE_NBITS {
+		bits[n/32] &^= 1 << (n % 32)
+	}
+}
+
+// Clear all bits.
+func (bits *EthtoolLinkModeBits) Reset() {
+	for i := range bits {
+		bits[i] = 0
+	}
+}
+
+func (bits *EthtoolLinkModeBits) IsEmpty() bool {
+	for _, w := range bits {
+		if w != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Set bits that are set in other.
+func (bits *EthtoolLinkModeBits) Union(other *EthtoolLinkModeBits) *EthtoolLinkModeBits {
+	for i := range bits {
+		bits[i] |= other[i]
+	}
+	return bits
+}
+
+// Clear bits that aren't set in other.
+func (bits *EthtoolLinkModeBits) Intersection(other *EthtoolLinkModeBits) *EthtoolLinkModeBits {
+	for i := range bits {
+		bits[i] &= other[i]
+	}
+	return bits
+}
+
+// Clear bits that are set in other.
+func (bits *EthtoolLinkModeBits) Difference(other *EthtoolLinkModeBits) *EthtoolLinkModeBits {
+	for i := range bits {
+		bits[i] &^= other[i]
+	}
+	return bits
+}
+
+// Call given function with each set mode ceasing on error.
+func (bits *EthtoolLinkModeBits) Iterate(f func(EthtoolLinkMode) error) error {
+	for i := range EthtoolLinkModes {
 		if bits.Test(uint(i)) {
-			fmt.Fprint(buf, "\n\t\t", s)
-			none = false
+			if err := f(EthtoolLinkMode(i)); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
+}
+
+// Return the highest speed of the set modes.
+func (bits *EthtoolLinkModeBits) HighestSpeed() Mbps {
+	var highest Mbps
+	bits.Iterate(func(mode EthtoolLinkMode) error {
+		if speed := mode.Speed(); speed > highest {
+			highest = speed
+		}
+		return nil
+	})
+	return highest
+}
+
+func (bits *EthtoolLinkModeBits) String() string {
+	buf := new(bytes.Buffer)
+	none := true
+	bits.Iterate(func(mode EthtoolLinkMode) error {
+		fmt.Fprint(buf, "\n\t\t", mode)
+		none = false
+		return nil
+	})
 	if none {
 		return "\tnone"
 	}
@@ -158,5 +479,6 @@ func (bits *EthtoolLinkModeBits) String() string {
 }
 
 func (bits *EthtoolLinkModeBits) Test(n uint) bool {
-	return (bits[n/32] & (1 << n)) != 0
+	return n < ETHTOOL_LINK_MODE_NBITS &&
+		(bits[n/32]&(1<<(n%32))) != 0
 }
@@ -0,0 +1,134 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import "testing"
+
+func TestEthtoolLinkModeBits(t *testing.T) {
+	var supported, advertising, partner EthtoolLinkModeBits
+	if err := supported.Parse("25000baseCR/Full,100000baseCR4/Full" +
+		" 40000baseCR4/Full|100000baseLR4_ER4/Full"); err != nil {
+		t.Fatal(err)
+	}
+	if err := supported.Parse("100000baseXX/Full"); err == nil {
+		t.Error("parsed unknown mode")
+	}
+	if !supported.Test(ETHTOOL_LINK_MODE_100000baseCR4_Full) {
+		t.Error("missing", EthtoolLinkMode(ETHTOOL_LINK_MODE_100000baseCR4_Full))
+	}
+	advertising.Load(&supported)
+	advertising.Clear(ETHTOOL_LINK_MODE_100000baseCR4_Full)
+	if advertising.Test(ETHTOOL_LINK_MODE_100000baseCR4_Full) {
+		t.Error("didn't clear 100000baseCR4/Full")
+	}
+	for _, n := range []uint{ETHTOOL_LINK_MODE_NBITS, 1 << 20} {
+		partner.Set(n)
+		partner.Clear(n)
+		if partner.Test(n) || !partner.IsEmpty() {
+			t.Error("out of range bit", n)
+		}
+	}
+	partner.Set(ETHTOOL_LINK_MODE_25000baseCR_Full)
+	partner.Set(ETHTOOL_LINK_MODE_40000baseCR4_Full)
+	partner.Set(ETHTOOL_LINK_MODE_100000baseCR4_Full)
+	if mbps := HighestCommonSpeed((*Advertising)(&advertising),
+		(*Partner)(&partner)); mbps != 40000 {
+		t.Error("highest common speed", mbps)
+	}
+	var diff EthtoolLinkModeBits
+	diff.Load(&supported)
+	diff.Difference(&advertising)
+	n := 0
+	diff.Iterate(func(mode EthtoolLinkMode) error {
+		if mode != ETHTOOL_LINK_MODE_100000baseCR4_Full {
+			t.Error("unexpected", mode)
+		}
+		n++
+		return nil
+	})
+	if n != 1 {
+		t.Error("difference has", n, "modes")
+	}
+	diff.Union(&partner).Intersection(&advertising)
+	if diff.HighestSpeed() != 40000 {
+		t.Error("union/intersection", diff.String())
+	}
+	diff.Reset()
+	if err := diff.Parse("RS 400000baseCR4/Full"); err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Test(ETHTOOL_LINK_MODE_FEC_RS) ||
+		diff.HighestSpeed() != 400000 {
+		t.Error("extended modes", diff.String())
+	}
+	diff.Reset()
+	if err := diff.Parse("10000baseR_FEC BASER 1000baseT/Full"); err != nil {
+		t.Fatal(err)
+	}
+	if diff.HighestSpeed() != 1000 {
+		t.Error("FEC modes as speeds", diff.String())
+	}
+	partner.Reset()
+	partner.Set(ETHTOOL_LINK_MODE_10000baseR_FEC)
+	partner.Set(ETHTOOL_LINK_MODE_FEC_BASER)
+	if mbps := HighestCommonSpeed((*Advertising)(&diff),
+		(*Partner)(&partner)); mbps != 0 {
+		t.Error("highest common FEC speed", mbps)
+	}
+	for _, mode := range []EthtoolLinkMode{
+		ETHTOOL_LINK_MODE_10000baseR_FEC,
+		ETHTOOL_LINK_MODE_FEC_NONE,
+		ETHTOOL_LINK_MODE_FEC_RS,
+		ETHTOOL_LINK_MODE_FEC_BASER,
+		ETHTOOL_LINK_MODE_FEC_LLRS,
+	} {
+		if mode.Speed() != 0 {
+			t.Error(mode, "speed", mode.Speed())
+		}
+	}
+	diff.Reset()
+	if !diff.IsEmpty() {
+		t.Error("not empty after reset")
+	}
+}
+
+func TestEthtoolLinkModeLanes(t *testing.T) {
+	for name, lanes := range map[string]int{
+		"100000baseCR4/Full":     4,
+		"100000baseLR4_ER4/Full": 4,
+		"50000baseCR2/Full":      2,
+		"25000baseCR/Full":       1,
+		"10000baseR_FEC":         0,
+		"400000baseCR8/Full":     8,
+		"Autoneg":                0,
+	} {
+		mode, found := EthtoolLinkModeOf(name)
+		if !found {
+			t.Fatal(name, "unknown")
+		}
+		if n := mode.Lanes(); n != lanes {
+			t.Error(name, "has", n, "lanes, expected", lanes)
+		}
+	}
+}
@@ -26,40 +26,248 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
 type Netns uint64
 
 const DefaultNetns Netns = 1
 
-var nameByInode = map[Netns]string{
-	1: "default",
+const (
+	NetnsRunDir    = "/run/netns"
+	NetnsDockerDir = "/var/run/docker/netns"
+	NetnsProcDir   = "/proc"
+)
+
+// Name prefix of netns only found through /proc/<pid>/ns/net
+const NetnsPidPrefix = "pid:"
+
+// NetnsResolver maps netns inodes to names and nsfs files, and back.
+type NetnsResolver struct {
+	// Directories of named netns bind mounts, searched in order.
+	Dirs []string
+	// If set, search /proc/<pid>/ns/net for netns not in Dirs.
+	Proc bool
+
+	mutex   sync.Mutex
+	mtimes  map[string]time.Time
+	byInode map[Netns]*netnsEntry
+	byName  map[string]Netns
+}
+
+type netnsEntry struct {
+	name string
+	path string
+	// directory of path or empty if found through /proc
+	dir string
+}
+
+// Netnses resolves named netns in /run/netns; append NetnsDockerDir to Dirs
+// and set Proc to search further.
+var Netnses = NetnsResolver{
+	Dirs: []string{NetnsRunDir},
+}
+
+// Return netns inode of the given name.
+func NetnsOf(name string) (Netns, bool) {
+	return Netnses.Netns(name)
 }
 
 func (ns Netns) String() string {
-	name, found := nameByInode[ns]
-	if found {
+	if name, found := Netnses.Name(ns); found {
 		return name
 	}
-	filepath.Walk("/run",
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if len(name) > 0 {
-				return filepath.SkipDir
-			}
-			stat := info.Sys().(*syscall.Stat_t)
-			if stat.Ino == uint64(ns) {
-				name = info.Name()
-				return filepath.SkipDir
+	return fmt.Sprintf("%#x", uint64(ns))
+}
+
+// Return name of the given netns inode.
+func (r *NetnsResolver) Name(ns Netns) (string, bool) {
+	if ns == DefaultNetns {
+		return "default", true
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if entry := r.resolve(ns); entry != nil {
+		return entry.name, true
+	}
+	return "", false
+}
+
+// Return nsfs file of the given netns inode.
+func (r *NetnsResolver) Path(ns Netns) (string, bool) {
+	if ns == DefaultNetns {
+		return filepath.Join(NetnsProcDir, "1", "ns", "net"), true
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if entry := r.resolve(ns); entry != nil {
+		return entry.path, true
+	}
+	return "", false
+}
+
+// Return netns inode of the given name.
+func (r *NetnsResolver) Netns(name string) (Netns, bool) {
+	if name == "default" {
+		return DefaultNetns, true
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.refresh(false)
+	if ns, found := r.byName[name]; found {
+		if entry := r.byInode[ns]; entry != nil && r.valid(ns, entry) {
+			return ns, true
+		}
+		r.forget(ns)
+	}
+	if r.Proc && strings.HasPrefix(name, NetnsPidPrefix) {
+		pid := strings.TrimPrefix(name, NetnsPidPrefix)
+		if _, err := strconv.Atoi(pid); err == nil {
+			path := filepath.Join(NetnsProcDir, pid, "ns", "net")
+			if ns, err := inodeOf(path); err == nil {
+				r.remember(ns, name, path, "")
+				return ns, true
 			}
-			return nil
-		})
-	if len(name) > 0 {
-		nameByInode[ns] = name
-		return name
+		}
 	}
-	return fmt.Sprintf("%#x", uint64(ns))
+	return 0, false
+}
+
+// Forget all cached netns and rescan on next lookup.
+func (r *NetnsResolver) Refresh() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.refresh(true)
+}
+
+func (r *NetnsResolver) resolve(ns Netns) *netnsEntry {
+	r.refresh(false)
+	if entry := r.byInode[ns]; entry != nil {
+		if r.valid(ns, entry) {
+			return entry
+		}
+		r.forget(ns)
+	}
+	if r.Proc {
+		r.scanProc()
+		return r.byInode[ns]
+	}
+	return nil
+}
+
+// Rescan each directory that has changed since last scanned.
+func (r *NetnsResolver) refresh(force bool) {
+	if r.mtimes == nil || force {
+		r.mtimes = make(map[string]time.Time)
+		r.byInode = make(map[Netns]*netnsEntry)
+		r.byName = make(map[string]Netns)
+	}
+	for _, dir := range r.Dirs {
+		var mtime time.Time
+		if info, err := os.Stat(dir); err == nil {
+			mtime = info.ModTime()
+		}
+		if last, found := r.mtimes[dir]; found && last.Equal(mtime) {
+			continue
+		}
+		r.mtimes[dir] = mtime
+		r.scanDir(dir)
+	}
+}
+
+func (r *NetnsResolver) scanDir(dir string) {
+	for ns, entry := range r.byInode {
+		if entry.dir == dir {
+			r.forget(ns)
+		}
+	}
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, ent := range ents {
+		path := filepath.Join(dir, ent.Name())
+		if ns, err := inodeOf(path); err == nil {
+			r.remember(ns, ent.Name(), path, dir)
+		}
+	}
+}
+
+func (r *NetnsResolver) scanProc() {
+	ents, err := os.ReadDir(NetnsProcDir)
+	if err != nil {
+		return
+	}
+	for _, ent := range ents {
+		if _, err := strconv.Atoi(ent.Name()); err != nil {
+			continue
+		}
+		path := filepath.Join(NetnsProcDir, ent.Name(), "ns", "net")
+		ns, err := inodeOf(path)
+		if err != nil {
+			continue
+		}
+		if _, found := r.byInode[ns]; !found {
+			r.remember(ns, NetnsPidPrefix+ent.Name(), path, "")
+		}
+	}
+}
+
+func (r *NetnsResolver) remember(ns Netns, name, path, dir string) {
+	if entry, found := r.byInode[ns]; found {
+		// keep the first named bind mount of this netns
+		if entry.dir != "" && (dir == "" || r.precedes(entry.dir, dir)) {
+			return
+		}
+		r.forget(ns)
+	}
+	r.byInode[ns] = &netnsEntry{name: name, path: path, dir: dir}
+	if other, found := r.byName[name]; found && other != ns {
+		// keep the name of the first directory searched
+		if entry := r.byInode[other]; entry != nil && entry.dir != "" &&
+			(dir == "" || r.precedes(entry.dir, dir)) {
+			return
+		}
+	}
+	r.byName[name] = ns
+}
+
+func (r *NetnsResolver) forget(ns Netns) {
+	if entry, found := r.byInode[ns]; found {
+		if r.byName[entry.name] == ns {
+			delete(r.byName, entry.name)
+		}
+		delete(r.byInode, ns)
+	}
+}
+
+// Returns true if dir a is searched before dir b.
+func (r *NetnsResolver) precedes(a, b string) bool {
+	for _, dir := range r.Dirs {
+		switch dir {
+		case a:
+			return true
+		case b:
+			return false
+		}
+	}
+	return false
+}
+
+// An entry is valid while its file still refers to the same netns.
+func (r *NetnsResolver) valid(ns Netns, entry *netnsEntry) bool {
+	inode, err := inodeOf(entry.path)
+	return err == nil && inode == ns
+}
+
+func inodeOf(path string) (Netns, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return 0, err
+	}
+	return Netns(stat.Ino), nil
 }
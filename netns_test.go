@@ -0,0 +1,137 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNetnsResolver(t *testing.T) {
+	run, docker := t.TempDir(), t.TempDir()
+	touch := func(dir, name string) Netns {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		ns, err := inodeOf(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ns
+	}
+	// rescan is by mtime so step it to not depend on its granularity
+	mtime := time.Now()
+	step := func(dir string) {
+		mtime = mtime.Add(time.Second)
+		if err := os.Chtimes(dir, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := &NetnsResolver{Dirs: []string{run, docker}}
+
+	a := touch(run, "a")
+	b := touch(docker, "b")
+	touch(docker, "a")
+	if ns, found := r.Netns("a"); !found || ns != a {
+		t.Error("a", ns, found)
+	}
+	if ns, found := r.Netns("b"); !found || ns != b {
+		t.Error("b", ns, found)
+	}
+	if path, found := r.Path(a); !found || path != filepath.Join(run, "a") {
+		t.Error("path of a", path, found)
+	}
+	if name, found := r.Name(b); !found || name != "b" {
+		t.Error("name of b", name, found)
+	}
+	if path, found := r.Path(DefaultNetns); !found ||
+		path != "/proc/1/ns/net" {
+		t.Error("default path", path, found)
+	}
+
+	c := touch(run, "c")
+	step(run)
+	if name, found := r.Name(c); !found || name != "c" {
+		t.Error("rescan", name, found)
+	}
+
+	// replace a without a rescan so that only valid() notices
+	touch(run, "a.new")
+	if err := os.Rename(filepath.Join(run, "a.new"),
+		filepath.Join(run, "a")); err != nil {
+		t.Fatal(err)
+	}
+	step(run)
+	r.mtimes[run] = mtime
+	if ns, found := r.Netns("a"); found {
+		t.Error("stale a", ns)
+	}
+	if _, found := r.Name(a); found {
+		t.Error("stale inode of a")
+	}
+
+	r.Refresh()
+	if ns, found := r.Netns("a"); !found || ns == a {
+		t.Error("refreshed a", ns, found)
+	}
+
+	pid := fmt.Sprint(NetnsPidPrefix, os.Getpid())
+	if _, found := r.Netns(pid); found {
+		t.Error("found", pid, "without Proc")
+	}
+	r.Proc = true
+	self, err := inodeOf("/proc/self/ns/net")
+	if err != nil {
+		t.Skip(err)
+	}
+	if ns, found := r.Netns(pid); !found || ns != self {
+		t.Error(pid, ns, found)
+	}
+	if path, found := r.Path(self); !found {
+		t.Error("path of", pid)
+	} else if ns, err := inodeOf(path); err != nil || ns != self {
+		t.Error("path of", pid, path, err)
+	}
+}
+
+func TestNetnsRemember(t *testing.T) {
+	r := &NetnsResolver{}
+	r.refresh(true)
+	r.remember(5, "pid:1", "/proc/1/ns/net", "")
+	r.remember(5, "a", "/run/netns/a", "/run/netns")
+	if _, found := r.byName["pid:1"]; found {
+		t.Error("stale pid:1")
+	}
+	if ns, found := r.byName["a"]; !found || ns != 5 {
+		t.Error("a", ns, found)
+	}
+	r.remember(5, "pid:2", "/proc/2/ns/net", "")
+	if entry := r.byInode[5]; entry == nil || entry.name != "a" {
+		t.Error("replaced bind mount with", entry)
+	}
+}
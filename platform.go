@@ -0,0 +1,98 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import "sync/atomic"
+
+// Platform describes a driver's ethtool names and front panel.
+type Platform struct {
+	// XETH driver name (e.g. "platina-mk1")
+	Name string
+	// Ethtool private flag and stat names indexed by the driver
+	EthtoolPrivFlagNames []string
+	EthtoolStatNames     []string
+	// Front panel ports, lanes, breakouts, and interface names
+	PortMap
+}
+
+// Generic is the Platform of unregistered drivers; it leaves
+// EthtoolPrivFlagNames and EthtoolStatNames as assigned by the application
+// before the first Start.
+var Generic = Platform{Name: "generic"}
+
+// Names assigned by the application, restored by installing a Platform
+// without its own.
+var appEthtoolNames struct {
+	saved        bool
+	flags, stats []string
+}
+
+var platforms = make(map[string]*Platform)
+
+// Incremented with each install of ethtool names so that users of their
+// indices, like StatPusher, know to look them up again.
+var ethtoolNamesGeneration uint32
+
+// Register a Platform by driver name, typically from a platform package
+// init, e.g. github.com/platinasystems/xeth/platina/mk1.
+func RegisterPlatform(platform *Platform) {
+	platforms[platform.Name] = platform
+}
+
+// Return the Platform registered with the given driver name.
+func PlatformOf(driver string) (*Platform, bool) {
+	platform, found := platforms[driver]
+	return platform, found
+}
+
+// Return the Platform installed by Start.
+func CurrentPlatform() *Platform {
+	if xeth.platform == nil {
+		return &Generic
+	}
+	return xeth.platform
+}
+
+// Install platform's ethtool names in place of those of any previous
+// platform.
+func (platform *Platform) install() {
+	if !appEthtoolNames.saved {
+		appEthtoolNames.saved = true
+		appEthtoolNames.flags = EthtoolPrivFlagNames
+		appEthtoolNames.stats = EthtoolStatNames
+	}
+	EthtoolPrivFlagNames = appEthtoolNames.flags
+	if platform.EthtoolPrivFlagNames != nil {
+		EthtoolPrivFlagNames = platform.EthtoolPrivFlagNames
+	}
+	EthtoolStatNames = appEthtoolNames.stats
+	if platform.EthtoolStatNames != nil {
+		EthtoolStatNames = platform.EthtoolStatNames
+	}
+	EthtoolStatMap = nil
+	xeth.platform = platform
+	atomic.AddUint32(&ethtoolNamesGeneration, 1)
+}
+
+func (platform *Platform) String() string { return platform.Name }
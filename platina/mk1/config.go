@@ -0,0 +1,384 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package mk1
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/platinasystems/xeth"
+)
+
+// Config describes the desired front panel port state, e.g.
+//
+//	{"ports": [
+//		{"name": "eth-1-1", "speed": 100000, "fec": "cl91", "admin": "up"},
+//		{"port": 1, "subport": 0, "autoneg": true, "media": "copper"},
+//		{"port": 2, "breakout": 4}
+//	]}
+//
+// or the equivalent YAML, see LoadYAMLConfig.
+type Config struct {
+	Ports []PortConfig `json:"ports"`
+}
+
+// PortConfig is the desired state of the port interface with the given Name
+// or driver Port and Subport index. Zero value fields are left as is.
+type PortConfig struct {
+	Name    string `json:"name,omitempty"`
+	Port    *int   `json:"port,omitempty"`
+	Subport *int   `json:"subport,omitempty"`
+	// Mb/s
+	Speed   xeth.Mbps `json:"speed,omitempty"`
+	Autoneg *bool     `json:"autoneg,omitempty"`
+	// "none", "cl74", or "cl91"
+	Fec string `json:"fec,omitempty"`
+	// "optical" or "copper"
+	Media string `json:"media,omitempty"`
+	// "up" or "down"
+	Admin string `json:"admin,omitempty"`
+	// Number of subports of the port: 1, 2, or 4
+	Breakout int `json:"breakout,omitempty"`
+}
+
+// Load and validate a JSON Config.
+func LoadConfig(r io.Reader) (*Config, error) {
+	config := new(Config)
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(config); err != nil {
+		return nil, err
+	}
+	for i := range config.Ports {
+		if err := config.Ports[i].Validate(); err != nil {
+			return nil, fmt.Errorf("ports[%d]: %v", i, err)
+		}
+	}
+	return config, nil
+}
+
+// Load and validate a YAML Config file if named "*.yaml" or "*.yml";
+// otherwise, a JSON Config file.
+func LoadConfigFile(fn string) (*Config, error) {
+	load := LoadConfig
+	switch ext := filepath.Ext(fn); ext {
+	case "", ".json":
+	case ".yaml", ".yml":
+		load = LoadYAMLConfig
+	default:
+		return nil, fmt.Errorf("%s: %s config unsupported, use JSON or YAML",
+			fn, ext)
+	}
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	config, err := load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	return config, nil
+}
+
+// Returns nil if the port config is consistent.
+func (pc *PortConfig) Validate() error {
+	if len(pc.Name) == 0 && pc.Port == nil {
+		return fmt.Errorf("missing name or port")
+	}
+	if pc.Port != nil && (*pc.Port < 0 || *pc.Port >= Ports) {
+		return fmt.Errorf("port %d out of range", *pc.Port)
+	}
+	if pc.Subport != nil && (*pc.Subport < 0 || *pc.Subport >= Lanes) {
+		return fmt.Errorf("subport %d out of range", *pc.Subport)
+	}
+	if len(pc.Fec) > 0 {
+		fec, err := ParseFec(pc.Fec)
+		if err != nil {
+			return err
+		}
+		if err = fec.Validate(pc.Speed); err != nil {
+			return err
+		}
+	}
+	if len(pc.Media) > 0 {
+		if _, err := ParseMedia(pc.Media); err != nil {
+			return err
+		}
+	}
+	switch pc.Admin {
+	case "", "up", "down":
+	default:
+		return fmt.Errorf("admin %q unknown", pc.Admin)
+	}
+	if pc.Breakout != 0 {
+		if _, found := PortMap.Breakout(pc.Breakout, 0); !found {
+			return fmt.Errorf("breakout %d invalid", pc.Breakout)
+		}
+	}
+	return nil
+}
+
+// Returns true if the port config describes the given interface.
+func (pc *PortConfig) Matches(entry *xeth.InterfaceEntry) bool {
+	if entry.DevType != xeth.XETH_DEVTYPE_XETH_PORT {
+		return false
+	}
+	if len(pc.Name) > 0 {
+		return entry.Name == pc.Name
+	}
+	if int(entry.Port) != *pc.Port {
+		return false
+	}
+	return pc.Subport == nil || int(entry.Subport) == *pc.Subport
+}
+
+func (pc *PortConfig) String() string {
+	if len(pc.Name) > 0 {
+		return pc.Name
+	}
+	if pc.Subport == nil {
+		return fmt.Sprint("port ", *pc.Port)
+	}
+	return fmt.Sprint("port ", *pc.Port, " subport ", *pc.Subport)
+}
+
+// Drift is a difference between the configured and cached port state.
+type Drift struct {
+	Ifindex    int32
+	Name       string
+	Attr       string
+	Have, Want string
+	// Applied by the reconciler unless it requires a driver reload
+	Manual bool
+
+	config *PortConfig
+}
+
+func (drift Drift) String() string {
+	s := fmt.Sprint(drift.Name, " ", drift.Attr, " ", drift.Have, " -> ",
+		drift.Want)
+	if drift.Manual {
+		s += " (requires driver reload)"
+	}
+	return s
+}
+
+// Reconciler compares its Config with the interface cache and applies the
+// differences through the driver.
+type Reconciler struct {
+	*Config
+	// If set, Reconcile only prints its plan
+	DryRun bool
+	// If not nil, Reconcile prints each Drift to this writer
+	Out io.Writer
+}
+
+// Return the differences between Config and the interface cache.
+func (r *Reconciler) Drift() ([]Drift, error) {
+	var drifts []Drift
+	var errs []string
+	for i := range r.Ports {
+		pc := &r.Ports[i]
+		n := 0
+		xeth.Interface.Iterate(func(entry *xeth.InterfaceEntry) error {
+			if !pc.Matches(entry) {
+				return nil
+			}
+			n++
+			d, derrs := pc.drift(entry)
+			drifts = append(drifts, d...)
+			errs = append(errs, derrs...)
+			return nil
+		})
+		if n == 0 {
+			errs = append(errs, fmt.Sprint(pc, ": no such interface"))
+		}
+	}
+	return drifts, joinErrors(errs)
+}
+
+// Print, then unless DryRun, apply the differences between Config and the
+// interface cache; returns the drift found.
+func (r *Reconciler) Reconcile() ([]Drift, error) {
+	drifts, err := r.Drift()
+	var errs []string
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	if r.Out != nil {
+		for _, drift := range drifts {
+			fmt.Fprintln(r.Out, drift)
+		}
+	}
+	if r.DryRun {
+		return drifts, joinErrors(errs)
+	}
+	byIfindex := make(map[int32][]Drift)
+	var ifindexes []int32
+	for _, drift := range drifts {
+		if drift.Manual {
+			continue
+		}
+		if _, found := byIfindex[drift.Ifindex]; !found {
+			ifindexes = append(ifindexes, drift.Ifindex)
+		}
+		byIfindex[drift.Ifindex] = append(byIfindex[drift.Ifindex],
+			drift)
+	}
+	for _, ifindex := range ifindexes {
+		if err := r.apply(ifindex, byIfindex[ifindex]); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	return drifts, joinErrors(errs)
+}
+
+// Return the drift of each attribute that differs and the errors of those
+// that can't be applied.
+func (pc *PortConfig) drift(entry *xeth.InterfaceEntry) ([]Drift, []string) {
+	var drifts []Drift
+	var errs []string
+	add := func(attr string, have, want interface{}) {
+		drifts = append(drifts, Drift{
+			Ifindex: entry.Index,
+			Name:    entry.Name,
+			Attr:    attr,
+			Have:    fmt.Sprint(have),
+			Want:    fmt.Sprint(want),
+			config:  pc,
+		})
+	}
+	if pc.Speed != 0 && pc.Speed != entry.EthtoolSettings.Speed {
+		if err := xeth.ValidateSpeed(entry.Index, pc.Speed); err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			add("speed", entry.EthtoolSettings.Speed, pc.Speed)
+		}
+	}
+	if pc.Autoneg != nil {
+		want := xeth.Autoneg(xeth.AUTONEG_DISABLE)
+		if *pc.Autoneg {
+			want = xeth.AUTONEG_ENABLE
+		}
+		if want != entry.EthtoolSettings.Autoneg {
+			add("autoneg", entry.EthtoolSettings.Autoneg, want)
+		}
+	}
+	if len(pc.Fec) > 0 {
+		want, _ := ParseFec(pc.Fec)
+		have, err := FecOf(entry)
+		if err != nil || want != have {
+			add("fec", have, want)
+		}
+	}
+	if len(pc.Media) > 0 {
+		want, _ := ParseMedia(pc.Media)
+		if have := MediaOf(entry); want != have {
+			add("media", have, want)
+		}
+	}
+	if len(pc.Admin) > 0 {
+		have := "down"
+		if entry.AdminUp() {
+			have = "up"
+		}
+		if have != pc.Admin {
+			add("admin", have, pc.Admin)
+		}
+	}
+	if pc.Breakout != 0 {
+		subports := xeth.Interface.Subports(int(entry.Port))
+		if have := len(subports); have != pc.Breakout {
+			add("breakout", have, pc.Breakout)
+			drifts[len(drifts)-1].Manual = true
+		}
+	}
+	return drifts, errs
+}
+
+// Apply an interface's drift with at most one settings or speed message,
+// one flags message, and the admin state.
+func (r *Reconciler) apply(ifindex int32, drifts []Drift) error {
+	entry := xeth.Interface.Indexed(ifindex)
+	if entry == nil {
+		return fmt.Errorf("ifindex %d: no such interface", ifindex)
+	}
+	settings := entry.EthtoolSettings
+	flags := entry.EthtoolPrivFlags
+	var speed, autoneg, setFlags, admin, up bool
+	for _, drift := range drifts {
+		pc := drift.config
+		switch drift.Attr {
+		case "speed":
+			settings.Speed = pc.Speed
+			speed = true
+		case "autoneg":
+			settings.Autoneg = xeth.AUTONEG_DISABLE
+			if *pc.Autoneg {
+				settings.Autoneg = xeth.AUTONEG_ENABLE
+			}
+			autoneg = true
+		case "fec":
+			fec, _ := ParseFec(pc.Fec)
+			flags = fec.PrivFlags(flags)
+			setFlags = true
+		case "media":
+			media, _ := ParseMedia(pc.Media)
+			flags = media.PrivFlags(flags)
+			setFlags = true
+		case "admin":
+			admin = true
+			up = pc.Admin == "up"
+		}
+	}
+	var err error
+	switch {
+	case autoneg:
+		err = xeth.SetEthtoolSettings(ifindex, &settings)
+	case speed:
+		err = xeth.SetSpeed(ifindex, settings.Speed)
+	}
+	if err == nil && setFlags {
+		err = xeth.SetEthtoolFlags(ifindex, flags)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", entry.Name, err)
+	}
+	if admin {
+		return xeth.SetAdmin(ifindex, up)
+	}
+	return nil
+}
+
+func joinErrors(errs []string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(errs, "; "))
+}
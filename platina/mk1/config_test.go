@@ -0,0 +1,277 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package mk1
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/xeth"
+	"github.com/platinasystems/xeth/sim"
+)
+
+func TestLoadConfig(t *testing.T) {
+	config, err := LoadConfig(strings.NewReader(`{"ports": [
+		{"name": "eth-1-1", "speed": 100000, "fec": "rs", "admin": "up"},
+		{"port": 1, "subport": 0, "autoneg": true, "media": "copper"},
+		{"port": 2, "breakout": 4}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Ports) != 3 || config.Ports[0].Speed != 100000 ||
+		*config.Ports[1].Port != 1 || !*config.Ports[1].Autoneg ||
+		config.Ports[2].Breakout != 4 {
+		t.Errorf("%+v", config.Ports)
+	}
+	for _, s := range []string{
+		`{"ports": [{"speed": 100000}]}`,
+		`{"ports": [{"port": 32}]}`,
+		`{"ports": [{"name": "eth-1-1", "fec": "cl74", "speed": 100000}]}`,
+		`{"ports": [{"name": "eth-1-1", "media": "twisted"}]}`,
+		`{"ports": [{"name": "eth-1-1", "breakout": 3}]}`,
+		`{"ports": [{"name": "eth-1-1", "mtu": 9000}]}`,
+	} {
+		if _, err = LoadConfig(strings.NewReader(s)); err == nil {
+			t.Error("loaded", s)
+		}
+	}
+}
+
+func TestLoadYAMLConfig(t *testing.T) {
+	config, err := LoadYAMLConfig(strings.NewReader(`---
+# front panel
+ports:
+- name: eth-1-1
+  speed: 100000
+  fec: "rs"   # same as cl91
+  admin: 'up'
+-
+  port: 1
+  subport: 0
+  autoneg: true
+  media: copper
+- {port: 2, breakout: 4}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Ports) != 3 || config.Ports[0].Speed != 100000 ||
+		config.Ports[0].Fec != "rs" || config.Ports[0].Admin != "up" ||
+		*config.Ports[1].Port != 1 || !*config.Ports[1].Autoneg ||
+		config.Ports[2].Breakout != 4 {
+		t.Errorf("%+v", config.Ports)
+	}
+	for _, s := range []string{
+		"ports:\n  - speed: 100000\n",
+		"ports: [{port: 32}]\n",
+		"ports:\n  - name: eth-1-1\n    mtu: 9000\n",
+		"ports:\n  - name: eth-1-1\n   speed: 100000\n",
+		"ports:\n  - name: eth-1-1\n    name: eth-2-1\n",
+		"ports:\n  - &port {name: eth-1-1}\n",
+		"ports:\n  - {name: \"eth-1-1}\n",
+		"ports: eth-1-1\n",
+	} {
+		if _, err = LoadYAMLConfig(strings.NewReader(s)); err == nil {
+			t.Errorf("loaded %q", s)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	const (
+		json = `{"ports": [{"port": 2}]}`
+		yaml = "ports:\n  - port: 2\n"
+	)
+	for _, x := range []struct {
+		fn, s string
+		ok    bool
+	}{
+		{"ports.json", json, true},
+		{"ports", json, true},
+		{"ports.yaml", yaml, true},
+		{"ports.yml", yaml, true},
+		{"ports.yaml", "{ports: [{port: 2}]}", true},
+		{"ports.json", yaml, false},
+		{"ports.toml", json, false},
+	} {
+		fn := filepath.Join(dir, x.fn)
+		if err := os.WriteFile(fn, []byte(x.s), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := LoadConfigFile(fn)
+		if (err == nil) != x.ok {
+			t.Error(x.fn, err)
+		} else if err == nil && (len(config.Ports) != 1 ||
+			*config.Ports[0].Port != 2) {
+			t.Errorf("%s: %+v", x.fn, config.Ports)
+		}
+	}
+}
+
+func TestReconciler(t *testing.T) {
+	settings := func(speed xeth.Mbps, modes ...uint) *xeth.EthtoolSettings {
+		settings := &xeth.EthtoolSettings{
+			Speed:   speed,
+			Autoneg: xeth.AUTONEG_DISABLE,
+			Duplex:  xeth.DUPLEX_FULL,
+		}
+		supported := (*xeth.EthtoolLinkModeBits)(&settings.Supported)
+		for _, mode := range modes {
+			supported.Set(mode)
+		}
+		return settings
+	}
+	s := &sim.Simulator{
+		Addr: "@xeth-mk1-test",
+		Interfaces: []sim.Interface{
+			{
+				Name:      "eth-1-1",
+				Ifindex:   3,
+				Flags:     xeth.IFF_UP,
+				PrivFlags: 1 << Fec74Bit,
+				Settings: settings(40000,
+					xeth.ETHTOOL_LINK_MODE_40000baseCR4_Full,
+					xeth.ETHTOOL_LINK_MODE_100000baseCR4_Full),
+			},
+			{
+				Name:      "eth-2-1",
+				Ifindex:   4,
+				Port:      1,
+				Flags:     xeth.IFF_UP,
+				PrivFlags: 1 << CopperBit,
+				Settings: settings(100000,
+					xeth.ETHTOOL_LINK_MODE_100000baseCR4_Full),
+			},
+		},
+	}
+	if err := s.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer s.Stop()
+	defer func(addr string) { xeth.DriverAddr = addr }(xeth.DriverAddr)
+	xeth.DriverAddr = s.Addr
+	if err := xeth.Start("platina-mk1"); err != nil {
+		t.Fatal(err)
+	}
+	defer xeth.Stop()
+
+	config, err := LoadConfig(strings.NewReader(`{"ports": [
+		{"name": "eth-1-1", "speed": 100000, "fec": "cl91"},
+		{"port": 1, "subport": 0, "speed": 25000, "autoneg": true,
+			"media": "optical", "breakout": 4},
+		{"name": "eth-9-1"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := func(drifts []Drift) string {
+		var s []string
+		for _, drift := range drifts {
+			s = append(s, drift.Name+" "+drift.Attr)
+		}
+		sort.Strings(s)
+		return strings.Join(s, ", ")
+	}
+	received := func() (n uint64) {
+		for _, kind := range []xeth.Kind{
+			xeth.XETH_MSG_KIND_SPEED,
+			xeth.XETH_MSG_KIND_ETHTOOL_FLAGS,
+			xeth.XETH_MSG_KIND_ETHTOOL_SETTINGS,
+		} {
+			n += s.Received(kind)
+		}
+		return
+	}
+	// the errors of unsupported speed and unknown interface mustn't
+	// hide the other drift
+	expectErr := func(err error) {
+		t.Helper()
+		if err == nil || !strings.Contains(err.Error(),
+			"eth-2-1: 25000Mb/s not supported") ||
+			!strings.Contains(err.Error(),
+				"eth-9-1: no such interface") {
+			t.Error(err)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	r := &Reconciler{Config: config, DryRun: true, Out: out}
+	n := received()
+	drifts, err := r.Reconcile()
+	expectErr(err)
+	const want = "eth-1-1 fec, eth-1-1 speed," +
+		" eth-2-1 autoneg, eth-2-1 breakout, eth-2-1 media"
+	if s := attrs(drifts); s != want {
+		t.Error("drift", s)
+	}
+	if lines := strings.Count(out.String(), "\n"); lines != 5 {
+		t.Error("printed", lines, "lines")
+	}
+	if !strings.Contains(out.String(),
+		"eth-2-1 breakout 1 -> 4 (requires driver reload)") {
+		t.Error("printed", out)
+	}
+
+	r.DryRun = false
+	r.Out = nil
+	_, err = r.Reconcile()
+	expectErr(err)
+	// eth-1-1 speed and flags, then eth-2-1 settings and flags
+	for i := 0; received() < n+4; i++ {
+		if i == 100 {
+			t.Fatal("received", received()-n, "messages")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	speed := xeth.ToMsgSpeed(s.Last(xeth.XETH_MSG_KIND_SPEED))
+	if speed.Ifindex != 3 || speed.Mbps != 100000 {
+		t.Errorf("%+v", speed)
+	}
+	ethtool := xeth.ToMsgEthtoolSettings(
+		s.Last(xeth.XETH_MSG_KIND_ETHTOOL_SETTINGS))
+	if ethtool.Ifindex != 4 || ethtool.Autoneg != xeth.AUTONEG_ENABLE ||
+		ethtool.Speed != 100000 {
+		t.Errorf("%+v", ethtool)
+	}
+	flags := xeth.ToMsgEthtoolFlags(s.Last(xeth.XETH_MSG_KIND_ETHTOOL_FLAGS))
+	if flags.Ifindex != 4 || flags.Flags != 0 {
+		t.Errorf("%+v", flags)
+	}
+	if fec, _ := FecOf(xeth.Interface.Indexed(3)); fec != FecCl91 {
+		t.Error("eth-1-1 fec", fec)
+	}
+
+	drifts, err = r.Drift()
+	expectErr(err)
+	if s := attrs(drifts); s != "eth-2-1 breakout" {
+		t.Error("drift after reconcile", s)
+	}
+}
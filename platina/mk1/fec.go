@@ -0,0 +1,178 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package mk1
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/platinasystems/xeth"
+)
+
+// Forward error correction encoded by the fec74 and fec91 private flags.
+type Fec uint8
+
+const (
+	FecNone Fec = iota
+	// Clause 74, BASE-R or FireCode FEC
+	FecCl74
+	// Clause 91, RS or Reed-Solomon FEC
+	FecCl91
+)
+
+// Media encoded by the copper private flag.
+type Media uint8
+
+const (
+	MediaOptical Media = iota
+	MediaCopper
+)
+
+// Return Fec of the given name, ignoring case and separators, e.g. "Base_R".
+func ParseFec(s string) (Fec, error) {
+	switch xeth.Hyphenate(strings.ToLower(s)) {
+	case "none", "off":
+		return FecNone, nil
+	case "cl74", "fec74", "baser", "base-r", "fc":
+		return FecCl74, nil
+	case "cl91", "fec91", "rs":
+		return FecCl91, nil
+	}
+	return FecNone, fmt.Errorf("fec %q unknown", s)
+}
+
+// Return Media of the given name, ignoring case and separators.
+func ParseMedia(s string) (Media, error) {
+	switch xeth.Hyphenate(strings.ToLower(s)) {
+	case "optical", "fiber", "fibre":
+		return MediaOptical, nil
+	case "copper":
+		return MediaCopper, nil
+	}
+	return MediaOptical, fmt.Errorf("media %q unknown", s)
+}
+
+// Return Fec encoded in private flags.
+func FecOfPrivFlags(flags xeth.EthtoolPrivFlags) (Fec, error) {
+	cl74, cl91 := flags.Test(Fec74Bit), flags.Test(Fec91Bit)
+	switch {
+	case cl74 && cl91:
+		return FecNone, fmt.Errorf("fec74 and fec91 are exclusive")
+	case cl74:
+		return FecCl74, nil
+	case cl91:
+		return FecCl91, nil
+	}
+	return FecNone, nil
+}
+
+// Return Media encoded in private flags.
+func MediaOfPrivFlags(flags xeth.EthtoolPrivFlags) Media {
+	if flags.Test(CopperBit) {
+		return MediaCopper
+	}
+	return MediaOptical
+}
+
+// Return Fec of the cached interface.
+func FecOf(entry *xeth.InterfaceEntry) (Fec, error) {
+	return FecOfPrivFlags(entry.EthtoolPrivFlags)
+}
+
+// Return Media of the cached interface.
+func MediaOf(entry *xeth.InterfaceEntry) Media {
+	return MediaOfPrivFlags(entry.EthtoolPrivFlags)
+}
+
+// Return the given private flags with their fec bits replaced by this Fec.
+func (fec Fec) PrivFlags(flags xeth.EthtoolPrivFlags) xeth.EthtoolPrivFlags {
+	flags &^= (1 << Fec74Bit) | (1 << Fec91Bit)
+	switch fec {
+	case FecCl74:
+		flags |= 1 << Fec74Bit
+	case FecCl91:
+		flags |= 1 << Fec91Bit
+	}
+	return flags
+}
+
+func (fec Fec) String() string {
+	var fecs = []string{
+		"none",
+		"cl74",
+		"cl91",
+	}
+	i := int(fec)
+	if i < len(fecs) {
+		return fecs[i]
+	}
+	return fmt.Sprint("@", i)
+}
+
+// Returns nil if the Fec is available at the given speed. Clause 74 applies
+// to 10G lanes and their aggregates along with 25G and 50G; whereas, clause
+// 91 applies to 25G lanes and their aggregates, so 100G is either RS or none.
+// Any Fec is accepted with an unspecified (autoneg) speed.
+func (fec Fec) Validate(speed xeth.Mbps) error {
+	var valid bool
+	switch fec {
+	case FecNone:
+		valid = true
+	case FecCl74:
+		switch speed {
+		case 0, 10000, 20000, 25000, 40000, 50000:
+			valid = true
+		}
+	case FecCl91:
+		switch speed {
+		case 0, 25000, 50000, 100000:
+			valid = true
+		}
+	}
+	if !valid {
+		return fmt.Errorf("fec %s invalid at %s", fec, speed)
+	}
+	return nil
+}
+
+// Return the given private flags with the copper bit replaced by this Media.
+func (media Media) PrivFlags(flags xeth.EthtoolPrivFlags) xeth.EthtoolPrivFlags {
+	flags &^= 1 << CopperBit
+	if media == MediaCopper {
+		flags |= 1 << CopperBit
+	}
+	return flags
+}
+
+func (media Media) String() string {
+	var medias = []string{
+		"optical",
+		"copper",
+	}
+	i := int(media)
+	if i < len(medias) {
+		return medias[i]
+	}
+	return fmt.Sprint("@", i)
+}
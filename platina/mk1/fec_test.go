@@ -0,0 +1,104 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package mk1
+
+import (
+	"testing"
+
+	"github.com/platinasystems/xeth"
+)
+
+func TestFec(t *testing.T) {
+	for s, want := range map[string]Fec{
+		"none":   FecNone,
+		"Off":    FecNone,
+		"cl74":   FecCl74,
+		"Base_R": FecCl74,
+		"base r": FecCl74,
+		"FEC91":  FecCl91,
+		"rs":     FecCl91,
+	} {
+		if fec, err := ParseFec(s); err != nil || fec != want {
+			t.Error(s, fec, err)
+		}
+	}
+	if _, err := ParseFec("cl108"); err == nil {
+		t.Error("parsed cl108")
+	}
+	for s, want := range map[string]Media{
+		"optical": MediaOptical,
+		"Fibre":   MediaOptical,
+		"COPPER":  MediaCopper,
+	} {
+		if media, err := ParseMedia(s); err != nil || media != want {
+			t.Error(s, media, err)
+		}
+	}
+	if _, err := ParseMedia("twinax"); err == nil {
+		t.Error("parsed twinax")
+	}
+
+	flags := xeth.EthtoolPrivFlags(1<<CopperBit | 1<<Fec74Bit)
+	for _, fec := range []Fec{FecNone, FecCl74, FecCl91} {
+		got, err := FecOfPrivFlags(fec.PrivFlags(flags))
+		if err != nil || got != fec {
+			t.Error(fec, "round trip", got, err)
+		}
+		if !fec.PrivFlags(flags).Test(CopperBit) {
+			t.Error(fec, "cleared copper")
+		}
+	}
+	if _, err := FecOfPrivFlags(1<<Fec74Bit | 1<<Fec91Bit); err == nil {
+		t.Error("accepted fec74 and fec91")
+	}
+	for _, media := range []Media{MediaOptical, MediaCopper} {
+		if got := MediaOfPrivFlags(media.PrivFlags(flags)); got != media {
+			t.Error(media, "round trip", got)
+		}
+		if !media.PrivFlags(flags).Test(Fec74Bit) {
+			t.Error(media, "cleared fec74")
+		}
+	}
+
+	for _, x := range []struct {
+		Fec
+		xeth.Mbps
+		valid bool
+	}{
+		{FecNone, 100000, true},
+		{FecCl74, 0, true},
+		{FecCl74, 10000, true},
+		{FecCl74, 40000, true},
+		{FecCl74, 100000, false},
+		{FecCl91, 0, true},
+		{FecCl91, 25000, true},
+		{FecCl91, 100000, true},
+		{FecCl91, 10000, false},
+		{FecCl91, 40000, false},
+	} {
+		if err := x.Fec.Validate(x.Mbps); (err == nil) != x.valid {
+			t.Error(x.Fec, x.Mbps, err)
+		}
+	}
+}
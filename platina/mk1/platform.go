@@ -0,0 +1,57 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package mk1
+
+import "github.com/platinasystems/xeth"
+
+const (
+	Name  = "platina-mk1"
+	Ports = 32
+	Lanes = 4
+)
+
+var Platform = xeth.Platform{
+	Name:                 Name,
+	EthtoolPrivFlagNames: EthtoolFlags,
+	EthtoolStatNames:     EthtoolStats,
+	PortMap:              PortMap,
+}
+
+// 32 QSFP28 ports of four 25G lanes
+var PortMap = xeth.PortMap{
+	Ports:     Ports,
+	Lanes:     Lanes,
+	Connector: "QSFP28",
+	Breakouts: []xeth.Breakout{
+		{Subports: 1, Speed: 100000},
+		{Subports: 1, Speed: 40000},
+		{Subports: 2, Speed: 50000},
+		{Subports: 4, Speed: 25000},
+		{Subports: 4, Speed: 10000},
+	},
+}
+
+func init() {
+	xeth.RegisterPlatform(&Platform)
+}
@@ -0,0 +1,71 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package mk1
+
+import (
+	"testing"
+
+	"github.com/platinasystems/xeth"
+)
+
+func TestPortMap(t *testing.T) {
+	for _, name := range []string{"eth-1-1", "eth-32-4", "eth-7-2"} {
+		port, subport, err := PortMap.Parse(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := PortMap.Name(port, subport); s != name {
+			t.Error(name, "formatted as", s)
+		}
+	}
+	for _, name := range []string{"eth-0-1", "eth-33-1", "eth-1-5",
+		"xeth-1-1", "eth-1"} {
+		if _, _, err := PortMap.Parse(name); err == nil {
+			t.Error("parsed", name)
+		}
+	}
+	b, err := xeth.ParseBreakout("2x50g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = PortMap.Validate(b); err != nil {
+		t.Error(err)
+	}
+	if first, n := PortMap.LanesOf(b, 1); first != 2 || n != 2 {
+		t.Error("2x50G subport 1 lanes", first, n)
+	}
+	if subport := PortMap.SubportOf(b, 3); subport != 1 {
+		t.Error("2x50G lane 3 subport", subport)
+	}
+	if b, err = xeth.ParseBreakout("4x25G"); err != nil {
+		t.Fatal(err)
+	}
+	names := PortMap.Names(2, b)
+	if len(names) != 4 || names[3] != "eth-3-4" || b.String() != "4x25G" {
+		t.Error(b, names)
+	}
+	if b, _ = xeth.ParseBreakout("3x33g"); PortMap.Validate(b) == nil {
+		t.Error("validated", b)
+	}
+}
@@ -0,0 +1,305 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package mk1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/platinasystems/xeth"
+)
+
+// Stat dimensions encoded in an EthtoolStats name, e.g.
+// "mmu-tx-cpu-cos-12-drop-bytes" is an mmu, tx, cpu, queue 12, drop of bytes.
+type Stat struct {
+	Index xeth.EthtoolStat
+	Name  string
+	Block
+	Direction
+	Class
+	// Cos or cpu queue; -1 if none
+	Queue int
+	// Special queue, "qm" or "sc"; empty if none
+	QueueName string
+	// Pfc or xon/xoff priority; -1 if none
+	Priority int
+	// Packet size range in bytes; 0 if any size
+	MinSize, MaxSize int
+	Drop             bool
+	Unit
+}
+
+type Block uint8
+type Direction uint8
+type Class uint8
+type Unit uint8
+
+const (
+	BlockNone Block = iota
+	BlockMmu
+	BlockPort
+	BlockRxPipe
+	BlockTxPipe
+)
+
+const (
+	DirectionNone Direction = iota
+	DirectionRx
+	DirectionTx
+)
+
+const (
+	ClassNone Class = iota
+	ClassUnicast
+	ClassMulticast
+	ClassBroadcast
+	ClassCpu
+	ClassWred
+)
+
+const (
+	UnitCount Unit = iota
+	UnitBytes
+	UnitPackets
+	UnitEvents
+	UnitDuration
+)
+
+var stats struct {
+	once sync.Once
+	list []Stat
+}
+
+// Return the parsed dimensions of all EthtoolStats.
+func Stats() []Stat {
+	stats.once.Do(func() {
+		stats.list = make([]Stat, len(EthtoolStats))
+		for i, name := range EthtoolStats {
+			stats.list[i] = ParseStat(name)
+			stats.list[i].Index = xeth.EthtoolStat(i)
+		}
+	})
+	return stats.list
+}
+
+// Return the EthtoolStats matching the given filter, e.g. all tx cos drops:
+//
+//	mk1.Query(func(stat *mk1.Stat) bool {
+//		return stat.Direction == mk1.DirectionTx &&
+//			stat.Queue >= 0 && stat.Drop
+//	})
+func Query(filter func(*Stat) bool) []Stat {
+	var matches []Stat
+	list := Stats()
+	for i := range list {
+		if filter(&list[i]) {
+			matches = append(matches, list[i])
+		}
+	}
+	return matches
+}
+
+// Return dimensions of the given stat name; the Index is left 0.
+func ParseStat(name string) Stat {
+	stat := Stat{
+		Name:     name,
+		Queue:    -1,
+		Priority: -1,
+	}
+	tokens := strings.Split(name, "-")
+	i := 0
+	switch {
+	case tokens[0] == "mmu":
+		stat.Block = BlockMmu
+		i = 1
+	case tokens[0] == "port":
+		stat.Block = BlockPort
+		i = 1
+	case len(tokens) > 1 && tokens[1] == "pipe":
+		switch tokens[0] {
+		case "rx":
+			stat.Block = BlockRxPipe
+			stat.Direction = DirectionRx
+			i = 2
+		case "tx":
+			stat.Block = BlockTxPipe
+			stat.Direction = DirectionTx
+			i = 2
+		}
+	}
+	number := func(j int) (int, bool) {
+		if j >= len(tokens) {
+			return 0, false
+		}
+		n, err := strconv.Atoi(tokens[j])
+		return n, err == nil
+	}
+	for ; i < len(tokens); i++ {
+		token := tokens[i]
+		switch token {
+		case "rx":
+			if stat.Direction == DirectionNone {
+				stat.Direction = DirectionRx
+			}
+			continue
+		case "tx":
+			if stat.Direction == DirectionNone {
+				stat.Direction = DirectionTx
+			}
+			continue
+		case "unicast", "multicast", "broadcast", "cpu", "wred":
+			if stat.Class == ClassNone {
+				stat.Class = map[string]Class{
+					"unicast":   ClassUnicast,
+					"multicast": ClassMulticast,
+					"broadcast": ClassBroadcast,
+					"cpu":       ClassCpu,
+					"wred":      ClassWred,
+				}[token]
+			}
+			if stat.Class == ClassWred {
+				// wred only applies to egress queues
+				stat.Direction = DirectionTx
+			}
+			continue
+		case "cos":
+			if n, ok := number(i + 1); ok {
+				stat.Queue = n
+				i++
+			}
+			continue
+		case "qm", "sc":
+			stat.QueueName = token
+			continue
+		case "priority":
+			if n, ok := number(i + 1); ok {
+				stat.Priority = n
+				i++
+			}
+			continue
+		case "drop", "drops", "dropped":
+			stat.Drop = true
+			continue
+		}
+		if strings.HasPrefix(token, "cos") {
+			if n, err := strconv.Atoi(token[3:]); err == nil {
+				stat.Queue = n
+			}
+		} else if strings.HasPrefix(token, "0x") {
+			if n, err := strconv.ParseInt(token[2:], 16, 0); err == nil {
+				stat.Queue = int(n)
+			}
+		} else if n, ok := number(i); ok {
+			// "<min>-to-<max>-byte" or "<size>-byte"
+			if i+3 < len(tokens) && tokens[i+1] == "to" &&
+				tokens[i+3] == "byte" {
+				if max, ok := number(i + 2); ok {
+					stat.MinSize, stat.MaxSize = n, max
+					i += 3
+				}
+			} else if i+1 < len(tokens) && tokens[i+1] == "byte" {
+				stat.MinSize, stat.MaxSize = n, n
+				i++
+			}
+		}
+	}
+	switch tokens[len(tokens)-1] {
+	case "bytes":
+		stat.Unit = UnitBytes
+	case "packets", "drops", "dropped", "errors", "fragments",
+		"collisions", "oversize":
+		stat.Unit = UnitPackets
+	case "events":
+		stat.Unit = UnitEvents
+	case "duration":
+		stat.Unit = UnitDuration
+	default:
+		if stat.Priority >= 0 {
+			// pfc frames
+			stat.Unit = UnitPackets
+		}
+	}
+	return stat
+}
+
+func (block Block) String() string {
+	var blocks = []string{
+		"none",
+		"mmu",
+		"port",
+		"rx-pipe",
+		"tx-pipe",
+	}
+	i := int(block)
+	if i < len(blocks) {
+		return blocks[i]
+	}
+	return fmt.Sprint("@", i)
+}
+
+func (direction Direction) String() string {
+	var directions = []string{
+		"none",
+		"rx",
+		"tx",
+	}
+	i := int(direction)
+	if i < len(directions) {
+		return directions[i]
+	}
+	return fmt.Sprint("@", i)
+}
+
+func (class Class) String() string {
+	var classes = []string{
+		"none",
+		"unicast",
+		"multicast",
+		"broadcast",
+		"cpu",
+		"wred",
+	}
+	i := int(class)
+	if i < len(classes) {
+		return classes[i]
+	}
+	return fmt.Sprint("@", i)
+}
+
+func (unit Unit) String() string {
+	var units = []string{
+		"count",
+		"bytes",
+		"packets",
+		"events",
+		"duration",
+	}
+	i := int(unit)
+	if i < len(units) {
+		return units[i]
+	}
+	return fmt.Sprint("@", i)
+}
@@ -0,0 +1,99 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package mk1
+
+import "testing"
+
+func TestParseStat(t *testing.T) {
+	for _, x := range []Stat{
+		{
+			Name:      "mmu-tx-cpu-cos-12-drop-bytes",
+			Block:     BlockMmu,
+			Direction: DirectionTx,
+			Class:     ClassCpu,
+			Queue:     12,
+			Priority:  -1,
+			Drop:      true,
+			Unit:      UnitBytes,
+		},
+		{
+			Name:      "port-rx-pfc-priority-3",
+			Block:     BlockPort,
+			Direction: DirectionRx,
+			Queue:     -1,
+			Priority:  3,
+			Unit:      UnitPackets,
+		},
+		{
+			Name:      "port-tx-1024-to-1518-byte-packets",
+			Block:     BlockPort,
+			Direction: DirectionTx,
+			Queue:     -1,
+			Priority:  -1,
+			MinSize:   1024,
+			MaxSize:   1518,
+			Unit:      UnitPackets,
+		},
+		{
+			Name:      "tx-pipe-multicast-queue-qm-bytes",
+			Block:     BlockTxPipe,
+			Direction: DirectionTx,
+			Class:     ClassMulticast,
+			Queue:     -1,
+			QueueName: "qm",
+			Priority:  -1,
+			Unit:      UnitBytes,
+		},
+		{
+			Name:      "mmu-wred-queue-cos5-drop-packets",
+			Block:     BlockMmu,
+			Direction: DirectionTx,
+			Class:     ClassWred,
+			Queue:     5,
+			Priority:  -1,
+			Drop:      true,
+			Unit:      UnitPackets,
+		},
+	} {
+		if stat := ParseStat(x.Name); stat != x {
+			t.Errorf("%s\n\tgot  %+v\n\twant %+v", x.Name, stat, x)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	drops := Query(func(stat *Stat) bool {
+		return stat.Direction == DirectionTx && stat.Queue >= 0 &&
+			stat.Drop && stat.Unit == UnitPackets
+	})
+	// 8 unicast, 8 multicast, 8 wred, and 48 cpu cos queues
+	if n := len(drops); n != 72 {
+		t.Error("found", n, "tx cos drop counters")
+	}
+	for _, stat := range drops {
+		if EthtoolStats[stat.Index] != stat.Name {
+			t.Errorf("%s index %d mismatch", stat.Name, stat.Index)
+		}
+	}
+}
@@ -0,0 +1,405 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package mk1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Load and validate a YAML Config, e.g.
+//
+//	ports:
+//	  - name: eth-1-1
+//	    speed: 100000
+//	    fec: cl91
+//	  - {port: 2, breakout: 4}
+//
+// This decodes the subset of YAML needed for configs: block and flow
+// mappings and sequences, comments, and plain or quoted scalars; anchors,
+// tags, and multi-line scalars are rejected. The result is checked like a
+// JSON Config.
+func LoadYAMLConfig(r io.Reader) (*Config, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	v, err := parseYAML(b)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		v = map[string]interface{}{}
+	}
+	b, err = json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return LoadConfig(bytes.NewReader(b))
+}
+
+type yamlLine struct {
+	n      int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+func parseYAML(b []byte) (interface{}, error) {
+	p := new(yamlParser)
+	for n, s := range strings.Split(string(b), "\n") {
+		s = strings.TrimRight(yamlUncomment(s), " \t\r")
+		text := strings.TrimLeft(s, " ")
+		if len(text) == 0 || s == "---" {
+			continue
+		}
+		if text[0] == '\t' {
+			return nil, fmt.Errorf("line %d: tab indentation", n+1)
+		}
+		p.lines = append(p.lines, yamlLine{
+			n:      n + 1,
+			indent: len(s) - len(text),
+			text:   text,
+		})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	v, err := p.block(p.lines[0].indent)
+	if err == nil && p.i < len(p.lines) {
+		err = p.errorf("unexpected indentation")
+	}
+	return v, err
+}
+
+// Strip a comment that isn't within a quoted scalar.
+func yamlUncomment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	n := 0
+	if p.i < len(p.lines) {
+		n = p.lines[p.i].n
+	} else if len(p.lines) > 0 {
+		n = p.lines[len(p.lines)-1].n
+	}
+	return fmt.Errorf("line %d: %s", n, fmt.Sprintf(format, args...))
+}
+
+func yamlIsItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// Parse the block sequence or mapping at the current line.
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	line := p.lines[p.i]
+	if line.indent != indent {
+		return nil, p.errorf("unexpected indentation")
+	}
+	if yamlIsItem(line.text) {
+		return p.sequence(indent)
+	}
+	if strings.ContainsAny(line.text[:1], "&*!|>@`%?") {
+		return nil, p.errorf("%q unsupported", line.text)
+	}
+	if strings.HasPrefix(line.text, "{") ||
+		strings.HasPrefix(line.text, "[") {
+		p.i++
+		return yamlFlow(line.text, line.n)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	seq := []interface{}{}
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent &&
+		yamlIsItem(p.lines[p.i].text) {
+		line := &p.lines[p.i]
+		rest := strings.TrimLeft(line.text[1:], " ")
+		var v interface{}
+		var err error
+		if len(rest) == 0 {
+			p.i++
+			if p.i < len(p.lines) && p.lines[p.i].indent > indent {
+				v, err = p.block(p.lines[p.i].indent)
+			}
+		} else {
+			// the item's content continues at its own indentation
+			line.indent += len(line.text) - len(rest)
+			line.text = rest
+			v, err = p.block(line.indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+	}
+	return seq, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := map[string]interface{}{}
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent {
+		line := p.lines[p.i]
+		if yamlIsItem(line.text) {
+			return nil, p.errorf("unexpected sequence item")
+		}
+		key, rest, err := yamlKey(line.text)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if _, found := m[key]; found {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.i++
+		var v interface{}
+		switch {
+		case len(rest) > 0:
+			v, err = yamlFlow(rest, line.n)
+		case p.i == len(p.lines):
+		case p.lines[p.i].indent > indent:
+			v, err = p.block(p.lines[p.i].indent)
+		case p.lines[p.i].indent == indent &&
+			yamlIsItem(p.lines[p.i].text):
+			// a sequence value may share the key's indentation
+			v, err = p.sequence(indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// Split "key: value" of a block mapping.
+func yamlKey(text string) (string, string, error) {
+	if text[0] == '"' || text[0] == '\'' {
+		fp := &yamlFlowParser{s: text}
+		key, err := fp.quoted()
+		if err != nil {
+			return "", "", err
+		}
+		rest := strings.TrimLeft(text[fp.i:], " ")
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", fmt.Errorf("missing ':' after key")
+		}
+		return key, strings.TrimLeft(rest[1:], " "), nil
+	}
+	if strings.HasSuffix(text, ":") {
+		return strings.TrimRight(text[:len(text)-1], " "), "", nil
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		return "", "", fmt.Errorf("expected key: value")
+	}
+	return strings.TrimRight(text[:i], " "),
+		strings.TrimLeft(text[i+2:], " "), nil
+}
+
+type yamlFlowParser struct {
+	s string
+	i int
+}
+
+// Parse a scalar or a single line flow mapping or sequence.
+func yamlFlow(s string, n int) (interface{}, error) {
+	fp := &yamlFlowParser{s: s}
+	v, err := fp.value(false)
+	if err == nil {
+		fp.space()
+		if fp.i < len(fp.s) {
+			err = fmt.Errorf("unexpected %q", fp.s[fp.i:])
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", n, err)
+	}
+	return v, nil
+}
+
+func (fp *yamlFlowParser) space() {
+	for fp.i < len(fp.s) && (fp.s[fp.i] == ' ' || fp.s[fp.i] == '\t') {
+		fp.i++
+	}
+}
+
+func (fp *yamlFlowParser) value(inFlow bool) (interface{}, error) {
+	fp.space()
+	if fp.i == len(fp.s) {
+		return nil, nil
+	}
+	switch fp.s[fp.i] {
+	case '{':
+		return fp.mapping()
+	case '[':
+		return fp.sequence()
+	case '"', '\'':
+		return fp.quoted()
+	case '&', '*', '!', '|', '>', '@', '`':
+		return nil, fmt.Errorf("%q unsupported", fp.s[fp.i:])
+	}
+	start := fp.i
+	for fp.i < len(fp.s) {
+		c := fp.s[fp.i]
+		if inFlow && (c == ',' || c == '}' || c == ']' || c == ':') {
+			break
+		}
+		fp.i++
+	}
+	return yamlScalar(strings.TrimRight(fp.s[start:fp.i], " \t")), nil
+}
+
+func (fp *yamlFlowParser) quoted() (string, error) {
+	q := fp.s[fp.i]
+	for j := fp.i + 1; j < len(fp.s); j++ {
+		switch {
+		case q == '"' && fp.s[j] == '\\':
+			j++
+		case fp.s[j] != q:
+		case q == '\'' && j+1 < len(fp.s) && fp.s[j+1] == '\'':
+			j++
+		case q == '"':
+			s, err := strconv.Unquote(fp.s[fp.i : j+1])
+			fp.i = j + 1
+			return s, err
+		default:
+			s := strings.Replace(fp.s[fp.i+1:j], "''", "'", -1)
+			fp.i = j + 1
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unterminated %q", fp.s[fp.i:])
+}
+
+func (fp *yamlFlowParser) expect(c byte) error {
+	fp.space()
+	if fp.i == len(fp.s) || fp.s[fp.i] != c {
+		return fmt.Errorf("expected %q in %q", c, fp.s)
+	}
+	fp.i++
+	return nil
+}
+
+// Parse the comma separated entries to the given closing bracket.
+func (fp *yamlFlowParser) entries(end byte, entry func() error) error {
+	fp.i++
+	for {
+		fp.space()
+		if fp.i < len(fp.s) && fp.s[fp.i] == end {
+			fp.i++
+			return nil
+		}
+		if err := entry(); err != nil {
+			return err
+		}
+		fp.space()
+		if fp.i < len(fp.s) && fp.s[fp.i] == ',' {
+			fp.i++
+		} else if err := fp.expect(end); err != nil {
+			return err
+		} else {
+			return nil
+		}
+	}
+}
+
+func (fp *yamlFlowParser) mapping() (interface{}, error) {
+	m := map[string]interface{}{}
+	err := fp.entries('}', func() error {
+		k, err := fp.value(true)
+		if err != nil {
+			return err
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = fmt.Sprint(k)
+		}
+		if err = fp.expect(':'); err != nil {
+			return err
+		}
+		if _, found := m[key]; found {
+			return fmt.Errorf("duplicate key %q", key)
+		}
+		m[key], err = fp.value(true)
+		return err
+	})
+	return m, err
+}
+
+func (fp *yamlFlowParser) sequence() (interface{}, error) {
+	seq := []interface{}{}
+	err := fp.entries(']', func() error {
+		v, err := fp.value(true)
+		seq = append(seq, v)
+		return err
+	})
+	return seq, err
+}
+
+// Resolve a plain scalar to null, bool, number, or string.
+func yamlScalar(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f
+	}
+	return s
+}
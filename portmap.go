@@ -0,0 +1,231 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PortMap models a platform's front panel: its ports, their serdes lanes,
+// the valid breakouts of each port into subports, and the interface naming
+// convention, "<Prefix>-<port>-<subport>" numbered from 1, e.g. "eth-1-1" is
+// driver port 0, subport 0.
+type PortMap struct {
+	// Front panel ports and serdes lanes per port
+	Ports, Lanes int
+	// Port connector, e.g. "QSFP28"
+	Connector string
+	// Interface name prefix, default "eth"
+	Prefix string
+	// Valid breakouts; the first is the default
+	Breakouts []Breakout
+}
+
+// Breakout of a port into Subports of the given Speed.
+type Breakout struct {
+	Subports int
+	Speed    Mbps
+}
+
+// Return the Breakout of strings like "4x25g", "2x50G", or "100g".
+func ParseBreakout(s string) (Breakout, error) {
+	var b Breakout
+	subports, speed := "1", strings.ToLower(s)
+	if i := strings.IndexAny(speed, "x*"); i >= 0 {
+		subports, speed = speed[:i], speed[i+1:]
+	}
+	n, err := strconv.Atoi(subports)
+	if err != nil || n <= 0 {
+		return b, fmt.Errorf("breakout %q invalid", s)
+	}
+	mult := 1
+	if strings.HasSuffix(speed, "g") {
+		mult = 1000
+		speed = strings.TrimSuffix(speed, "g")
+	}
+	mbps, err := strconv.ParseUint(speed, 10, 32)
+	if err != nil || mbps == 0 {
+		return b, fmt.Errorf("breakout %q invalid", s)
+	}
+	b.Subports = n
+	b.Speed = Mbps(mbps) * Mbps(mult)
+	return b, nil
+}
+
+func (b Breakout) String() string {
+	speed := fmt.Sprint(uint32(b.Speed), "M")
+	if b.Speed%1000 == 0 {
+		speed = fmt.Sprint(uint32(b.Speed/1000), "G")
+	}
+	return fmt.Sprint(b.Subports, "x", speed)
+}
+
+func (m *PortMap) prefix() string {
+	if len(m.Prefix) == 0 {
+		return "eth"
+	}
+	return m.Prefix
+}
+
+// Format the interface name of the given driver port and subport indices;
+// subport -1, a port without breakout, is named as subport 0.
+func (m *PortMap) Name(port, subport int) string {
+	if subport < 0 {
+		subport = 0
+	}
+	return fmt.Sprint(m.prefix(), "-", port+1, "-", subport+1)
+}
+
+// Parse an interface name into driver port and subport indices.
+func (m *PortMap) Parse(name string) (port, subport int, err error) {
+	fields := strings.Split(name, "-")
+	if len(fields) != 3 || fields[0] != m.prefix() {
+		err = fmt.Errorf("%q isn't a %s-PORT-SUBPORT name", name,
+			m.prefix())
+		return
+	}
+	if port, err = strconv.Atoi(fields[1]); err != nil ||
+		port < 1 || port > m.Ports {
+		err = fmt.Errorf("%q: port out of range", name)
+		return
+	}
+	if subport, err = strconv.Atoi(fields[2]); err != nil ||
+		subport < 1 || subport > m.Lanes {
+		err = fmt.Errorf("%q: subport out of range", name)
+		return
+	}
+	return port - 1, subport - 1, nil
+}
+
+// Return the valid Breakout with the given number of subports and speed;
+// speed 0 matches the first breakout with that many subports, e.g. both
+// 1x100G and 1x40G have one subport.
+func (m *PortMap) Breakout(subports int, speed Mbps) (Breakout, bool) {
+	for _, b := range m.Breakouts {
+		if b.Subports == subports && (speed == 0 || b.Speed == speed) {
+			return b, true
+		}
+	}
+	return Breakout{}, false
+}
+
+// Returns nil if the given breakout is valid.
+func (m *PortMap) Validate(b Breakout) error {
+	for _, valid := range m.Breakouts {
+		if valid == b {
+			return nil
+		}
+	}
+	return fmt.Errorf("breakout %s invalid", b)
+}
+
+// Return the first and number of lanes of a subport in the given breakout.
+func (m *PortMap) LanesOf(b Breakout, subport int) (first, n int) {
+	if b.Subports <= 0 || subport < 0 {
+		return 0, m.Lanes
+	}
+	n = m.Lanes / b.Subports
+	return subport * n, n
+}
+
+// Return the subport of a lane in the given breakout.
+func (m *PortMap) SubportOf(b Breakout, lane int) int {
+	if b.Subports <= 1 {
+		return 0
+	}
+	return lane / (m.Lanes / b.Subports)
+}
+
+// Return the interface names of a port with the given breakout.
+func (m *PortMap) Names(port int, b Breakout) []string {
+	names := make([]string, b.Subports)
+	for i := range names {
+		names[i] = m.Name(port, i)
+	}
+	return names
+}
+
+// Return the Breakout of the given port per the number of cached subports
+// and the cached speed of its first subport, or if that's unknown, the
+// first breakout with that many subports.
+func (m *PortMap) BreakoutOf(port int) (Breakout, bool) {
+	subports := Interface.Subports(port)
+	if len(subports) == 0 {
+		return Breakout{}, false
+	}
+	Interface.mutex.RLock()
+	speed := subports[0].EthtoolSettings.Speed
+	Interface.mutex.RUnlock()
+	return m.Breakout(len(subports), speed)
+}
+
+// Return the cached port interface of the given name.
+func (m *PortMap) Lookup(name string) (*InterfaceEntry, error) {
+	port, subport, err := m.Parse(name)
+	if err != nil {
+		return nil, err
+	}
+	entry := Interface.AtPort(port, subport)
+	if entry == nil {
+		return nil, fmt.Errorf("%s: no such interface", name)
+	}
+	return entry, nil
+}
+
+// Return the cached port interface with the given driver port and subport
+// indices; subport 0 also matches an unbroken port's subport -1.
+func (c *Ifcache) AtPort(port, subport int) *InterfaceEntry {
+	for _, entry := range c.Subports(port) {
+		if int(entry.Subport) == subport ||
+			(subport == 0 && entry.Subport < 0) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Return the cached interfaces of the given driver port index sorted by
+// subport, the lowest ifindex of each.
+func (c *Ifcache) Subports(port int) []*InterfaceEntry {
+	var entries []*InterfaceEntry
+	subports := make(map[int8]struct{})
+	c.Iterate(func(entry *InterfaceEntry) error {
+		if entry.DevType != XETH_DEVTYPE_XETH_PORT ||
+			int(entry.Port) != port {
+			return nil
+		}
+		if _, found := subports[entry.Subport]; !found {
+			subports[entry.Subport] = struct{}{}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Subport < entries[j].Subport
+	})
+	return entries
+}
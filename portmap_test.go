@@ -0,0 +1,145 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import "testing"
+
+func TestPortMapCache(t *testing.T) {
+	testCache(t)
+	// ports beyond those of the simulated driver
+	const first, last = 1020, 1025
+	m := &PortMap{
+		Ports: 24,
+		Lanes: 4,
+		Breakouts: []Breakout{
+			{Subports: 1, Speed: 100000},
+			{Subports: 1, Speed: 40000},
+			{Subports: 4, Speed: 25000},
+			{Subports: 4, Speed: 10000},
+		},
+	}
+	port := func(ifindex int32, name string, port int16, subport int8,
+		devtype DevType, speed Mbps) {
+		buf := make([]byte, SizeofMsgIfinfo)
+		msg := ToMsgIfinfo(buf)
+		msg.Kind = XETH_MSG_KIND_IFINFO
+		copy(msg.Ifname[:], name)
+		msg.Net = uint64(DefaultNetns)
+		msg.Ifindex = ifindex
+		msg.Portindex = port
+		msg.Subportindex = subport
+		msg.Devtype = uint8(devtype)
+		msg.Reason = XETH_IFINFO_REASON_NEW
+		Kind(XETH_MSG_KIND_IFINFO).cache(buf)
+		buf = make([]byte, SizeofMsgEthtoolSettings)
+		settings := ToMsgEthtoolSettings(buf)
+		settings.Kind = uint8(XETH_MSG_KIND_ETHTOOL_SETTINGS)
+		settings.Ifindex = ifindex
+		settings.Speed = uint32(speed)
+		Kind(XETH_MSG_KIND_ETHTOOL_SETTINGS).cache(buf)
+	}
+	defer func() {
+		Interface.mutex.Lock()
+		defer Interface.mutex.Unlock()
+		for ifindex := int32(first); ifindex <= last; ifindex++ {
+			Interface.del(ifindex)
+		}
+	}()
+	// port 20 isn't broken out, port 21 is 4x10G listed out of order
+	// with a vlan on subport 1
+	port(1020, "eth-21-1", 20, -1, XETH_DEVTYPE_XETH_PORT, 40000)
+	port(1021, "eth-22-3", 21, 2, XETH_DEVTYPE_XETH_PORT, 10000)
+	port(1022, "eth-22-1", 21, 0, XETH_DEVTYPE_XETH_PORT, 10000)
+	port(1023, "eth-22-4", 21, 3, XETH_DEVTYPE_XETH_PORT, 10000)
+	port(1024, "eth-22-2", 21, 1, XETH_DEVTYPE_XETH_PORT, 10000)
+	port(1025, "eth-22-2.100", 21, 1, XETH_DEVTYPE_LINUX_VLAN, 10000)
+
+	subports := Interface.Subports(21)
+	if len(subports) != 4 {
+		t.Fatal("port 21 subports", len(subports))
+	}
+	for i, entry := range subports {
+		if int(entry.Subport) != i || entry.Name != m.Name(21, i) {
+			t.Error("port 21 subport", i, entry.Name)
+		}
+	}
+	if n := len(Interface.Subports(22)); n != 0 {
+		t.Error("port 22 subports", n)
+	}
+	for _, x := range []struct {
+		port, subport int
+		ifindex       int32
+	}{
+		{20, 0, 1020},
+		{20, 1, 0},
+		{21, 0, 1022},
+		{21, 1, 1024},
+		{21, 3, 1023},
+		{22, 0, 0},
+	} {
+		entry := Interface.AtPort(x.port, x.subport)
+		switch {
+		case entry == nil && x.ifindex != 0:
+			t.Error("no port", x.port, "subport", x.subport)
+		case entry != nil && entry.Index != x.ifindex:
+			t.Error("port", x.port, "subport", x.subport, "is",
+				entry.Index)
+		}
+	}
+	for name, ifindex := range map[string]int32{
+		"eth-21-1": 1020,
+		"eth-22-2": 1024,
+		"eth-22-4": 1023,
+		"eth-21-2": 0,
+		"eth-23-1": 0,
+		"eth-25-1": 0,
+	} {
+		entry, err := m.Lookup(name)
+		switch {
+		case ifindex == 0 && err == nil:
+			t.Error("found", name)
+		case ifindex != 0 && err != nil:
+			t.Error(err)
+		case ifindex != 0 && entry.Index != ifindex:
+			t.Error(name, "is", entry.Index)
+		}
+	}
+	for port, want := range map[int]string{
+		20: "1x40G",
+		21: "4x10G",
+	} {
+		if b, found := m.BreakoutOf(port); !found || b.String() != want {
+			t.Error("port", port, "breakout", b, found)
+		}
+	}
+	if b, found := m.BreakoutOf(22); found {
+		t.Error("port 22 breakout", b)
+	}
+	if b, found := m.Breakout(4, 0); !found || b.Speed != 25000 {
+		t.Error("default 4 subport breakout", b, found)
+	}
+	if b, found := m.Breakout(1, 50000); found {
+		t.Error("found breakout", b)
+	}
+}
@@ -0,0 +1,205 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// PrometheusExporter writes the Interface cache, the optional Counters, and
+// library Count in the Prometheus text exposition format. It's an
+// http.Handler, e.g.
+//
+//	http.Handle("/metrics", &xeth.PrometheusExporter{Counters: counters})
+//	go http.ListenAndServe("localhost:9100", nil)
+type PrometheusExporter struct {
+	Counters *Counters
+}
+
+type promMetric struct {
+	help, typ string
+	samples   []string
+}
+
+type promMetrics map[string]*promMetric
+
+func (p *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+func (p *PrometheusExporter) WriteTo(w io.Writer) (int64, error) {
+	return p.write(w, Interface.snapshot())
+}
+
+func (p *PrometheusExporter) write(w io.Writer, entries []InterfaceEntry) (int64,
+	error) {
+	metrics := make(promMetrics)
+	for i := range entries {
+		entry := &entries[i]
+		name := promLabels("ifindex", fmt.Sprint(entry.Index),
+			"name", entry.Name)
+		metrics.add("xeth_interface_info", "gauge",
+			"Interface name, devtype, port, subport, and netns.",
+			promLabels("ifindex", fmt.Sprint(entry.Index),
+				"name", entry.Name,
+				"devtype", entry.DevType.String(),
+				"port", fmt.Sprint(entry.Port),
+				"subport", fmt.Sprint(entry.Subport),
+				"netns", entry.Netns.String()), 1)
+		metrics.add("xeth_interface_admin_up", "gauge",
+			"Interface is administratively up.",
+			name, promBool(entry.AdminUp()))
+		metrics.add("xeth_interface_oper_up", "gauge",
+			"Interface is up and running.",
+			name, promBool(entry.OperUp()))
+		if entry.EthtoolSettings.Speed != 0 {
+			metrics.add("xeth_interface_speed_bits_per_second",
+				"gauge", "Interface link speed.", name,
+				uint64(entry.EthtoolSettings.Speed)*1000000)
+		}
+		if p.Counters != nil {
+			p.Counters.Iterate(entry.Index,
+				func(key CounterKey, counter Counter) error {
+					metric := "xeth_link_"
+					stat := LinkStat(key.Index).String()
+					if key.Kind == XETH_MSG_KIND_ETHTOOL_STAT {
+						metric = "xeth_ethtool_"
+						stat = EthtoolStat(key.Index).String()
+					}
+					metric += PrometheusName(stat) + "_total"
+					metrics.add(metric, "counter",
+						fmt.Sprintf("Interface %s counter.",
+							stat), name, counter.Count)
+					return nil
+				})
+		}
+	}
+	metrics.add("xeth_tx_sent_total", "counter",
+		"Messages queued by Tx.", "",
+		atomic.LoadUint64(&Count.Tx.Sent))
+	metrics.add("xeth_tx_dropped_total", "counter",
+		"Messages dropped by Tx.", "",
+		atomic.LoadUint64(&Count.Tx.Dropped))
+	for class := TxClass(0); class < NTxClasses; class++ {
+		counters := TxCounters(class)
+		labels := promLabels("class", class.String())
+		metrics.add("xeth_tx_class_queued_total", "counter",
+			"Messages queued by Tx class.", labels, counters.Queued)
+		metrics.add("xeth_tx_class_sent_total", "counter",
+			"Messages sent by Tx class.", labels, counters.Sent)
+		metrics.add("xeth_tx_class_dropped_total", "counter",
+			"Messages dropped by full Tx class.", labels,
+			counters.Dropped)
+		metrics.add("xeth_tx_class_errors_total", "counter",
+			"Messages that failed to send by Tx class.", labels,
+			counters.Errors)
+	}
+	metrics.add("xeth_rx_received_total", "counter",
+		"Messages received from the driver.", "",
+		atomic.LoadUint64(&Count.Rx.Received))
+	metrics.add("xeth_rx_invalid_total", "counter",
+		"Messages from the driver that failed validation.", "",
+		atomic.LoadUint64(&Count.Rx.Invalid))
+	for kind := range Count.Rx.Kinds {
+		if n := atomic.LoadUint64(&Count.Rx.Kinds[kind]); n > 0 {
+			metrics.add("xeth_rx_messages_total", "counter",
+				"Messages received from the driver by kind.",
+				promLabels("kind", Kind(kind).String()), n)
+		}
+	}
+	return metrics.writeTo(w)
+}
+
+// Return the given name with each character that is invalid in a
+// Prometheus metric name replaced by an underscore.
+func PrometheusName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		}
+		return '_'
+	}, Hyphenate(s))
+}
+
+func (metrics promMetrics) add(name, typ, help, labels string,
+	value interface{}) {
+	metric, found := metrics[name]
+	if !found {
+		metric = &promMetric{help: help, typ: typ}
+		metrics[name] = metric
+	}
+	metric.samples = append(metric.samples,
+		fmt.Sprint(name, labels, " ", value))
+}
+
+func (metrics promMetrics) writeTo(w io.Writer) (int64, error) {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := new(bytes.Buffer)
+	for _, name := range names {
+		metric := metrics[name]
+		fmt.Fprintln(buf, "# HELP", name, metric.help)
+		fmt.Fprintln(buf, "# TYPE", name, metric.typ)
+		for _, sample := range metric.samples {
+			fmt.Fprintln(buf, sample)
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+func promBool(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Return {name="value",...} of the given name, value pairs.
+func promLabels(pairs ...string) string {
+	buf := new(bytes.Buffer)
+	sep := "{"
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fmt.Fprint(buf, sep, pairs[i], "=\"",
+			promEscaper.Replace(pairs[i+1]), "\"")
+		sep = ","
+	}
+	if buf.Len() > 0 {
+		fmt.Fprint(buf, "}")
+	}
+	return buf.String()
+}
+
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
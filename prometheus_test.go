@@ -0,0 +1,96 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestPrometheusExporter(t *testing.T) {
+	entries := []InterfaceEntry{
+		{Ifinfo: Ifinfo{
+			Name:    "eth-1-1",
+			Index:   3,
+			Netns:   DefaultNetns,
+			DevType: XETH_DEVTYPE_XETH_PORT,
+			Flags:   IFF_UP | IFF_RUNNING,
+			Port:    0,
+			Subport: -1,
+		}},
+		{Ifinfo: Ifinfo{
+			Name:    "eth-2-1",
+			Index:   4,
+			Netns:   DefaultNetns,
+			DevType: XETH_DEVTYPE_XETH_PORT,
+			Flags:   IFF_UP,
+			Port:    1,
+			Subport: -1,
+		}},
+	}
+	entries[0].EthtoolSettings.Speed = 100000
+	buf := new(bytes.Buffer)
+	if _, err := new(PrometheusExporter).write(buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE xeth_interface_oper_up gauge",
+		`xeth_interface_admin_up{ifindex="3",name="eth-1-1"} 1`,
+		`xeth_interface_oper_up{ifindex="3",name="eth-1-1"} 1`,
+		`xeth_interface_admin_up{ifindex="4",name="eth-2-1"} 1`,
+		`xeth_interface_oper_up{ifindex="4",name="eth-2-1"} 0`,
+		`xeth_interface_speed_bits_per_second{ifindex="3",name="eth-1-1"} 100000000000`,
+		`xeth_interface_info{ifindex="4",name="eth-2-1",devtype="port",port="1",subport="-1",netns="default"} 1`,
+		"# TYPE xeth_rx_received_total counter",
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Error("missing", line)
+		}
+	}
+	if strings.Contains(out, `xeth_interface_speed_bits_per_second{ifindex="4"`) {
+		t.Error("speed of eth-2-1")
+	}
+	if t.Failed() {
+		t.Log(out)
+	}
+}
+
+func TestIfflagsOf(t *testing.T) {
+	flags := ifflagsOf(net.FlagUp | net.FlagMulticast | net.FlagRunning)
+	if flags != IFF_UP|IFF_RUNNING|syscall.IFF_MULTICAST {
+		t.Errorf("%#x", uint(flags))
+	}
+	info := Ifinfo{Flags: flags}
+	if !info.AdminUp() || !info.OperUp() {
+		t.Error("not up and running")
+	}
+	info.Flags = ifflagsOf(net.FlagUp | net.FlagMulticast)
+	if info.OperUp() {
+		t.Error("running without net.FlagRunning")
+	}
+}
@@ -0,0 +1,90 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// Call given function on a locked OS thread within this netns then restore
+// the thread's original netns. The thread is discarded if it can't be
+// restored.
+func (ns Netns) Do(f func() error) error {
+	path, found := Netnses.Path(ns)
+	if !found {
+		return fmt.Errorf("netns %s: no nsfs file", ns)
+	}
+	errch := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		restored, err := doInNetns(path, f)
+		if restored {
+			runtime.UnlockOSThread()
+		}
+		errch <- err
+	}()
+	return <-errch
+}
+
+// Returns false if the thread is left in the other netns.
+func doInNetns(path string, f func() error) (bool, error) {
+	self := fmt.Sprint("/proc/self/task/", syscall.Gettid(), "/ns/net")
+	orig, err := os.Open(self)
+	if err != nil {
+		return true, err
+	}
+	defer orig.Close()
+	target, err := os.Open(path)
+	if err != nil {
+		return true, err
+	}
+	defer target.Close()
+	if origns, err := inodeOf(self); err == nil {
+		if ns, err := inodeOf(path); err == nil && ns == origns {
+			return true, f()
+		}
+	}
+	if err = setns(target); err != nil {
+		return true, err
+	}
+	err = f()
+	if rerr := setns(orig); rerr != nil {
+		if err == nil {
+			err = rerr
+		}
+		return false, err
+	}
+	return true, err
+}
+
+func setns(f *os.File) error {
+	_, _, e := syscall.RawSyscall(sysSetns, f.Fd(), syscall.CLONE_NEWNET, 0)
+	if e != 0 {
+		return os.NewSyscallError("setns", e)
+	}
+	return nil
+}
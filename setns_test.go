@@ -0,0 +1,66 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestNetnsDo(t *testing.T) {
+	errf := errors.New("f")
+	called := false
+	f := func() error {
+		called = true
+		return errf
+	}
+
+	if err := Netns(0).Do(f); err == nil || called {
+		t.Error("unknown netns", called, err)
+	}
+	restored, err := doInNetns("/nonexistent", f)
+	if !restored || !os.IsNotExist(err) || called {
+		t.Error("bad path", restored, called, err)
+	}
+
+	// within the same netns, f is called without setns
+	restored, err = doInNetns("/proc/self/ns/net", f)
+	if !restored || err != errf || !called {
+		t.Error("same netns", restored, called, err)
+	}
+
+	path, found := Netnses.Path(DefaultNetns)
+	if !found || path != "/proc/1/ns/net" {
+		t.Error("default path", path, found)
+	}
+	called = false
+	err = DefaultNetns.Do(f)
+	if os.IsPermission(err) {
+		t.Skip(err)
+	}
+	if err != errf || !called {
+		t.Error("default netns", called, err)
+	}
+}
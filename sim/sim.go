@@ -0,0 +1,268 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+// Package sim simulates the driver side of the xeth socket for tests of
+// applications without the kernel module.
+package sim
+
+import (
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/platinasystems/xeth"
+)
+
+// Simulator serves the xeth protocol: it replies to hello with its own, to
+// ifinfo dumps with its Interfaces, their ethtool state, and a break, to fib dumps with a break, and
+// to sequenced requests with an ack or nak.
+type Simulator struct {
+	// Abstract socket address, default "@xeth"
+	Addr string
+	// Interfaces reported by ifinfo dumps
+	Interfaces []Interface
+	// If not nil, returns the errno to nak the given sequenced request,
+	// or zero to ack
+	Nak func(buf []byte) syscall.Errno
+	// Version and kinds reported by hello, default xeth.Version and
+	// xeth.KindSizes(); with Legacy, ignore hello like the original driver.
+	Version string
+	Sizes   *[xeth.XETH_HELLO_NKINDS]uint16
+	Legacy  bool
+
+	mutex    sync.Mutex
+	received map[xeth.Kind]uint64
+	last     map[xeth.Kind][]byte
+	ln       *net.UnixListener
+	conns    map[*net.UnixConn]struct{}
+	wg       sync.WaitGroup
+}
+
+type Interface struct {
+	Name    string
+	Ifindex int32
+	Netns   xeth.Netns
+	xeth.DevType
+	Port    int16
+	Subport int8
+	// Kernel net_device flags, e.g. xeth.IFF_UP
+	Flags uint32
+	Addr  net.HardwareAddr
+	// Ethtool private flags dumped with ports, and link settings dumped
+	// if not nil with Nwords per link mode mask, default that of
+	// xeth.MsgEthtoolSettings
+	PrivFlags xeth.EthtoolPrivFlags
+	Settings  *xeth.EthtoolSettings
+	Nwords    int
+}
+
+// Listen on Addr and serve each connection until Stop.
+func (s *Simulator) Start() error {
+	addr := s.Addr
+	if len(addr) == 0 {
+		addr = "@xeth"
+	}
+	ln, err := net.ListenUnix("unixpacket",
+		&net.UnixAddr{Name: addr, Net: "unixpacket"})
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	s.ln = ln
+	s.conns = make(map[*net.UnixConn]struct{})
+	if s.received == nil {
+		s.received = make(map[xeth.Kind]uint64)
+		s.last = make(map[xeth.Kind][]byte)
+	}
+	s.mutex.Unlock()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.AcceptUnix()
+			if err != nil {
+				return
+			}
+			s.mutex.Lock()
+			s.conns[conn] = struct{}{}
+			s.mutex.Unlock()
+			s.wg.Add(1)
+			go s.serve(conn)
+		}
+	}()
+	return nil
+}
+
+// Close the listener and connections then wait for their service routines.
+func (s *Simulator) Stop() {
+	s.mutex.Lock()
+	if s.ln != nil {
+		s.ln.Close()
+		s.ln = nil
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+}
+
+// Return the number of requests of the given kind received.
+func (s *Simulator) Received(kind xeth.Kind) uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.received[kind]
+}
+
+// Return a copy of the last request of the given kind received, or nil.
+func (s *Simulator) Last(kind xeth.Kind) []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]byte(nil), s.last[kind]...)
+}
+
+func (s *Simulator) serve(conn *net.UnixConn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+	buf := make([]byte, xeth.PageSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		kind := xeth.KindOf(buf[:n])
+		s.mutex.Lock()
+		s.received[kind]++
+		s.last[kind] = append(s.last[kind][:0], buf[:n]...)
+		s.mutex.Unlock()
+		switch kind {
+		case xeth.XETH_MSG_KIND_HELLO:
+			if !s.Legacy {
+				conn.Write(s.hello())
+			}
+		case xeth.XETH_MSG_KIND_DUMP_IFINFO:
+			for i := range s.Interfaces {
+				itf := &s.Interfaces[i]
+				conn.Write(itf.ifinfo())
+				if itf.DevType == xeth.XETH_DEVTYPE_XETH_PORT {
+					conn.Write(itf.ethtoolFlags())
+				}
+				if itf.Settings != nil {
+					conn.Write(itf.ethtoolSettings())
+				}
+			}
+			conn.Write(make([]byte, xeth.SizeofMsgBreak))
+		case xeth.XETH_MSG_KIND_DUMP_FIBINFO:
+			conn.Write(make([]byte, xeth.SizeofMsgBreak))
+		}
+		if seq, ok := xeth.ToMsg(buf[:n]).Seq(); ok {
+			conn.Write(s.ack(buf[:n], seq))
+		}
+	}
+}
+
+func (s *Simulator) ack(req []byte, seq uint32) []byte {
+	buf := make([]byte, xeth.SizeofMsgAck)
+	msg := xeth.ToMsgAck(buf)
+	msg.Kind = xeth.XETH_MSG_KIND_ACK
+	if s.Nak != nil {
+		if errno := s.Nak(req); errno != 0 {
+			msg.Kind = xeth.XETH_MSG_KIND_NAK
+			msg.Errno = int32(errno)
+		}
+	}
+	xeth.ToMsg(buf).SetSeq(seq)
+	return buf
+}
+
+func (s *Simulator) hello() []byte {
+	buf := make([]byte, xeth.SizeofMsgHello)
+	msg := xeth.ToMsgHello(buf)
+	msg.Kind = xeth.XETH_MSG_KIND_HELLO
+	version := s.Version
+	if len(version) == 0 {
+		version = xeth.Version
+	}
+	msg.Major, msg.Minor, msg.Patch, _ = xeth.ParseVersion(version)
+	msg.Nkinds = xeth.XETH_HELLO_NKINDS
+	if s.Sizes != nil {
+		msg.Sizes = *s.Sizes
+	} else {
+		msg.Sizes = xeth.KindSizes()
+	}
+	return buf
+}
+
+func (itf *Interface) ifinfo() []byte {
+	buf := make([]byte, xeth.SizeofMsgIfinfo)
+	msg := xeth.ToMsgIfinfo(buf)
+	msg.Kind = xeth.XETH_MSG_KIND_IFINFO
+	copy(msg.Ifname[:xeth.IFNAMSIZ-1], itf.Name)
+	msg.Net = uint64(itf.Netns)
+	if msg.Net == 0 {
+		msg.Net = uint64(xeth.DefaultNetns)
+	}
+	msg.Ifindex = itf.Ifindex
+	msg.Flags = itf.Flags
+	copy(msg.Addr[:], itf.Addr)
+	msg.Portindex = itf.Port
+	msg.Subportindex = itf.Subport
+	msg.Devtype = uint8(itf.DevType)
+	msg.Reason = xeth.XETH_IFINFO_REASON_DUMP
+	return buf
+}
+
+func (itf *Interface) ethtoolFlags() []byte {
+	buf := make([]byte, xeth.SizeofMsgEthtoolFlags)
+	msg := xeth.ToMsgEthtoolFlags(buf)
+	msg.Kind = uint8(xeth.XETH_MSG_KIND_ETHTOOL_FLAGS)
+	msg.Ifindex = itf.Ifindex
+	msg.Flags = uint32(itf.PrivFlags)
+	return buf
+}
+
+func (itf *Interface) ethtoolSettings() []byte {
+	nwords := itf.Nwords
+	if nwords == 0 {
+		nwords = xeth.XETH_LINK_MODE_MASKS_NWORDS
+	}
+	buf := make([]byte, xeth.SizeofMsgEthtoolSettingsNwords(nwords))
+	msg := xeth.ToMsgEthtoolSettings(buf)
+	msg.Kind = uint8(xeth.XETH_MSG_KIND_ETHTOOL_SETTINGS)
+	msg.Ifindex = itf.Ifindex
+	msg.Speed = uint32(itf.Settings.Speed)
+	msg.Duplex = uint8(itf.Settings.Duplex)
+	msg.Port = uint8(itf.Settings.DevPort)
+	msg.Autoneg = uint8(itf.Settings.Autoneg)
+	msg.Link_mode_masks_nwords = int8(nwords)
+	supported, advertising, partner := msg.LinkModeMasks()
+	copy(supported, itf.Settings.Supported[:])
+	copy(advertising, itf.Settings.Advertising[:])
+	copy(partner, itf.Settings.Partner[:])
+	return buf
+}
@@ -0,0 +1,134 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import "fmt"
+
+type SpeedErrorReason uint8
+
+const (
+	SpeedUnspecified SpeedErrorReason = iota
+	SpeedNoSuchInterface
+	SpeedNotSupported
+	SpeedExceedsBreakout
+)
+
+func (reason SpeedErrorReason) String() string {
+	var reasons = []string{
+		"unspecified",
+		"no such interface",
+		"not supported",
+		"exceeds lanes of breakout",
+	}
+	if i := int(reason); i < len(reasons) {
+		return reasons[i]
+	}
+	return fmt.Sprint("@", int(reason))
+}
+
+// SpeedError is returned by SetSpeed and ValidateSpeed with an impossible
+// interface speed.
+type SpeedError struct {
+	Ifindex int32
+	Speed   Mbps
+	// Lanes available to the interface, or 0 if unknown
+	Lanes  int
+	Reason SpeedErrorReason
+}
+
+func (err *SpeedError) Error() string {
+	name := fmt.Sprint("ifindex ", err.Ifindex)
+	if entry := Interface.cached(err.Ifindex); entry != nil {
+		name = entry.Name
+	}
+	switch err.Reason {
+	case SpeedUnspecified:
+		return fmt.Sprint(name, ": speed ", err.Reason)
+	case SpeedExceedsBreakout:
+		return fmt.Sprint(name, ": ", err.Speed, " ", err.Reason, " (",
+			err.Lanes, " lanes)")
+	}
+	return fmt.Sprint(name, ": ", err.Speed, " ", err.Reason)
+}
+
+// Return the number of serdes lanes of a port interface after dividing its
+// Platform Lanes among the port's subports, or 0 if unknown.
+func (entry *InterfaceEntry) Lanes() int {
+	lanes := CurrentPlatform().Lanes
+	if lanes == 0 || entry.DevType != XETH_DEVTYPE_XETH_PORT ||
+		entry.Port < 0 {
+		return 0
+	}
+	if n := len(Interface.Subports(int(entry.Port))); n > 1 {
+		lanes /= n
+	}
+	return lanes
+}
+
+// Validate an interface speed against its supported link modes and the lanes
+// of its port breakout.
+func ValidateSpeed(ifindex int32, speed Mbps) error {
+	err := &SpeedError{Ifindex: ifindex, Speed: speed}
+	entry := Interface.cached(ifindex)
+	if entry == nil {
+		err.Reason = SpeedNoSuchInterface
+		return err
+	}
+	if speed == 0 {
+		err.Reason = SpeedUnspecified
+		return err
+	}
+	err.Lanes = entry.Lanes()
+	err.Reason = SpeedNotSupported
+	supported := (*EthtoolLinkModeBits)(&entry.EthtoolSettings.Supported)
+	for i := range EthtoolLinkModes {
+		mode := EthtoolLinkMode(i)
+		if !supported.Test(uint(i)) || mode.Speed() != speed {
+			continue
+		}
+		if err.Lanes == 0 || mode.Lanes() <= err.Lanes {
+			return nil
+		}
+		err.Reason = SpeedExceedsBreakout
+	}
+	return err
+}
+
+// Send a validated speed change then cache the new speed once acked; or,
+// with a driver that doesn't ack, once it echoes its ethtool settings.
+func SetSpeed(ifindex int32, speed Mbps) error {
+	if err := ValidateSpeed(ifindex, speed); err != nil {
+		return err
+	}
+	buf := Pool.Get(SizeofMsgSpeed)
+	defer Pool.Put(buf)
+	msg := ToMsgSpeed(buf)
+	msg.Kind = uint8(XETH_MSG_KIND_SPEED)
+	msg.Ifindex = ifindex
+	msg.Mbps = uint32(speed)
+	if acked, err := request(buf); !acked {
+		return err
+	}
+	return Interface.set(ifindex, speed)
+}
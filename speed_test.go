@@ -0,0 +1,91 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import "testing"
+
+func TestValidateSpeed(t *testing.T) {
+	needDriver(t)
+	if CurrentPlatform().Lanes != 4 {
+		t.Skip(CurrentPlatform(), "doesn't have 4 lane ports")
+	}
+	port := func(ifindex int32, name string, subport int8,
+		modes ...uint) {
+		msg := &MsgIfinfo{
+			Net:          uint64(DefaultNetns),
+			Portindex:    99,
+			Subportindex: subport,
+			Devtype:      uint8(XETH_DEVTYPE_XETH_PORT),
+		}
+		copy(msg.Ifname[:], name)
+		testEntry(ifindex, msg)
+		Interface.mutex.Lock()
+		defer Interface.mutex.Unlock()
+		supported := (*EthtoolLinkModeBits)(
+			&Interface.index[ifindex].EthtoolSettings.Supported)
+		for _, mode := range modes {
+			supported.Set(mode)
+		}
+	}
+	del := func(ifindex int32) {
+		Interface.mutex.Lock()
+		defer Interface.mutex.Unlock()
+		Interface.del(ifindex)
+	}
+	defer del(1006)
+	defer del(1007)
+	port(1006, "t6", 0,
+		ETHTOOL_LINK_MODE_10000baseR_FEC,
+		ETHTOOL_LINK_MODE_FEC_BASER,
+		ETHTOOL_LINK_MODE_25000baseCR_Full,
+		ETHTOOL_LINK_MODE_50000baseCR2_Full,
+		ETHTOOL_LINK_MODE_100000baseCR4_Full)
+	valid := func(speed Mbps) {
+		t.Helper()
+		if err := ValidateSpeed(1006, speed); err != nil {
+			t.Error(speed, err)
+		}
+	}
+	invalid := func(speed Mbps, reason SpeedErrorReason, lanes int) {
+		t.Helper()
+		err, ok := ValidateSpeed(1006, speed).(*SpeedError)
+		if !ok || err.Reason != reason || err.Lanes != lanes {
+			t.Errorf("%s: %#v", speed, err)
+		}
+	}
+	valid(100000)
+	invalid(0, SpeedUnspecified, 0)
+	invalid(10000, SpeedNotSupported, 4)
+	invalid(40000, SpeedNotSupported, 4)
+	if err := ValidateSpeed(1005, 10000); err == nil {
+		t.Error("validated speed of uncached interface")
+	}
+
+	// breakout to 2 subports of 2 lanes each
+	port(1007, "t7", 1)
+	invalid(100000, SpeedExceedsBreakout, 2)
+	valid(50000)
+	valid(25000)
+	invalid(10000, SpeedNotSupported, 2)
+}
@@ -0,0 +1,216 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StatSource provides hardware counters by ifindex then link or ethtool stat
+// name, e.g. "rx-packets" or "port-rx-bytes".
+type StatSource interface {
+	Stats() (map[int32]map[string]uint64, error)
+}
+
+// StatPusher periodically sends the changed counters of its Source to the
+// driver with SetStats.
+type StatPusher struct {
+	Source StatSource
+	// Time between pushes, default 1s
+	Interval time.Duration
+	// If not nil, called with each Source or SetStats error
+	OnError func(error)
+
+	mutex    sync.Mutex
+	counters StatPusherCounters
+	// stat name to kind and index, or !valid if unknown, of the
+	// ethtoolNamesGeneration
+	keys       map[string]statKey
+	generation uint32
+	// last count sent by ifindex then kind and index
+	last map[int32]map[statKey]uint64
+	stop chan struct{}
+	done chan struct{}
+}
+
+type StatPusherCounters struct {
+	// Completed pushes and their errors
+	Pushes, Errors uint64
+	// Counters sent, skipped as unchanged, and dropped with unknown name
+	// or ifindex
+	Sent, Unchanged, Unknown uint64
+	// Time from scheduled to completed push
+	LastLag, MaxLag time.Duration
+	LastErr         error
+}
+
+type statKey struct {
+	kind  uint8
+	index uint16
+	valid bool
+}
+
+// Push every Interval until Stop.
+func (p *StatPusher) Start() {
+	interval := p.Interval
+	if interval == 0 {
+		interval = time.Second
+	}
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case scheduled := <-ticker.C:
+				err := p.Push()
+				lag := time.Since(scheduled)
+				p.mutex.Lock()
+				p.counters.LastLag = lag
+				if lag > p.counters.MaxLag {
+					p.counters.MaxLag = lag
+				}
+				p.mutex.Unlock()
+				if err != nil && p.OnError != nil {
+					p.OnError(err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop pushing and wait for any push in progress.
+func (p *StatPusher) Stop() {
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+	p.stop = nil
+}
+
+// Return a copy of the push counters.
+func (p *StatPusher) Counters() StatPusherCounters {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.counters
+}
+
+// Send the counters that have changed since last pushed.
+func (p *StatPusher) Push() error {
+	stats, err := p.Source.Stats()
+	if err != nil {
+		return p.pushed(err)
+	}
+	p.mutex.Lock()
+	// look up names again, and resend all counters, after the ethtool
+	// names change
+	generation := atomic.LoadUint32(&ethtoolNamesGeneration)
+	if p.keys == nil || p.generation != generation {
+		p.keys = make(map[string]statKey)
+		p.last = make(map[int32]map[statKey]uint64)
+		p.generation = generation
+	}
+	// forget ports that have left the cache so that all of their
+	// counters are sent if they return
+	for ifindex := range p.last {
+		if Interface.cached(ifindex) == nil {
+			delete(p.last, ifindex)
+		}
+	}
+	var entries []MsgStatsEntry
+	for ifindex, counts := range stats {
+		if Interface.cached(ifindex) == nil {
+			p.counters.Unknown += uint64(len(counts))
+			continue
+		}
+		last, found := p.last[ifindex]
+		if !found {
+			last = make(map[statKey]uint64)
+			p.last[ifindex] = last
+		}
+		for name, count := range counts {
+			key := p.keyOf(name)
+			if !key.valid {
+				p.counters.Unknown++
+				continue
+			}
+			if prev, found := last[key]; found && prev == count {
+				p.counters.Unchanged++
+				continue
+			}
+			entries = append(entries, MsgStatsEntry{
+				Ifindex: ifindex,
+				Index:   key.index,
+				Kind:    key.kind,
+				Count:   count,
+			})
+		}
+	}
+	p.mutex.Unlock()
+	if err = SetStats(entries); err != nil {
+		return p.pushed(err)
+	}
+	p.mutex.Lock()
+	for _, entry := range entries {
+		key := statKey{kind: entry.Kind, index: entry.Index, valid: true}
+		if last, found := p.last[entry.Ifindex]; found {
+			last[key] = entry.Count
+		}
+	}
+	p.counters.Sent += uint64(len(entries))
+	p.mutex.Unlock()
+	return p.pushed(nil)
+}
+
+// Map stat name to kind and index once.
+func (p *StatPusher) keyOf(name string) statKey {
+	key, found := p.keys[name]
+	if !found {
+		kind, index, found := StatIndexOf(name)
+		if found && index <= 0xffff {
+			key = statKey{kind: uint8(kind), index: uint16(index),
+				valid: true}
+		}
+		p.keys[name] = key
+	}
+	return key
+}
+
+func (p *StatPusher) pushed(err error) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.counters.Pushes++
+	if err != nil {
+		p.counters.Errors++
+		p.counters.LastErr = err
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type testStatSource struct {
+	stats map[int32]map[string]uint64
+	err   error
+}
+
+func (s *testStatSource) Stats() (map[int32]map[string]uint64, error) {
+	return s.stats, s.err
+}
+
+func TestStatPusher(t *testing.T) {
+	needDriver(t)
+	const ifindex = 1003
+	del := func() {
+		Interface.mutex.Lock()
+		defer Interface.mutex.Unlock()
+		Interface.del(ifindex)
+	}
+	testEntry(ifindex, "t3")
+	defer del()
+	source := &testStatSource{
+		stats: map[int32]map[string]uint64{
+			ifindex: {
+				"rx-packets":  1,
+				"tx-packets":  2,
+				"rx-nonsense": 3,
+			},
+			1004: {"rx-packets": 4},
+		},
+	}
+	p := &StatPusher{Source: source}
+	expect := func(sent, unchanged, unknown uint64) {
+		t.Helper()
+		if err := p.Push(); err != nil {
+			t.Fatal(err)
+		}
+		c := p.Counters()
+		if c.Sent != sent || c.Unchanged != unchanged ||
+			c.Unknown != unknown {
+			t.Errorf("sent %d, unchanged %d, unknown %d;"+
+				" expected %d, %d, %d", c.Sent, c.Unchanged,
+				c.Unknown, sent, unchanged, unknown)
+		}
+	}
+	expect(2, 0, 2)
+	source.stats[ifindex]["tx-packets"]++
+	expect(3, 1, 4)
+
+	// forget the counters of a removed port then resend them all
+	del()
+	expect(3, 1, 8)
+	testEntry(ifindex, "t3")
+	expect(5, 1, 10)
+
+	// resend all after the ethtool names change
+	CurrentPlatform().install()
+	expect(7, 1, 12)
+
+	errSource := errors.New("source")
+	source.err = errSource
+	errs := make(chan error, 1)
+	p.Interval = 10 * time.Millisecond
+	p.OnError = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	p.Start()
+	err := <-errs
+	p.Stop()
+	c := p.Counters()
+	if err != errSource || c.LastErr != errSource || c.Errors == 0 ||
+		c.Pushes < c.Errors {
+		t.Error("errors", err, c.Errors, c.Pushes, c.LastErr)
+	}
+	if c.LastLag <= 0 || c.MaxLag < c.LastLag {
+		t.Error("lag", c.LastLag, c.MaxLag)
+	}
+}
@@ -0,0 +1,138 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+const (
+	SizeofMsgStats      = 0x18
+	SizeofMsgStatsEntry = 0x10
+)
+
+// Batch of link and ethtool stat updates; N entries follow the header.
+type MsgStats struct {
+	Z64  uint64
+	Z32  uint32
+	Z16  uint16
+	Z8   uint8
+	Kind uint8
+	N    uint32
+	Pad  [4]uint8
+}
+
+type MsgStatsEntry struct {
+	Ifindex int32
+	Index   uint16
+	// XETH_MSG_KIND_LINK_STAT or XETH_MSG_KIND_ETHTOOL_STAT
+	Kind  uint8
+	Pad   uint8
+	Count uint64
+}
+
+func ToMsgStats(buf []byte) *MsgStats {
+	return (*MsgStats)(unsafe.Pointer(&buf[0]))
+}
+
+// Return the maximum number of entries of a page sized MsgStats.
+func MaxStatsEntries() int {
+	return (PageSize - 1 - SizeofMsgStats) / SizeofMsgStatsEntry
+}
+
+// Return kind and index of the given link or ethtool stat name.
+func StatIndexOf(stat string) (Kind, uint64, bool) {
+	if linkstat, found := LinkStatOf(stat); found {
+		return XETH_MSG_KIND_LINK_STAT, uint64(linkstat), true
+	} else if ethtoolstat, found := EthtoolStatOf(stat); found {
+		return XETH_MSG_KIND_ETHTOOL_STAT, uint64(ethtoolstat), true
+	}
+	return XETH_MSG_KIND_NOT_MSG, 0, false
+}
+
+// Queue stat updates in as few page sized messages as possible.
+func SetStats(entries []MsgStatsEntry) error {
+	max := MaxStatsEntries()
+	for len(entries) > 0 {
+		n := len(entries)
+		if n > max {
+			n = max
+		}
+		if err := setStats(entries[:n]); err != nil {
+			return err
+		}
+		entries = entries[n:]
+	}
+	return nil
+}
+
+func setStats(entries []MsgStatsEntry) error {
+	for i := range entries {
+		switch entries[i].Kind {
+		case XETH_MSG_KIND_LINK_STAT, XETH_MSG_KIND_ETHTOOL_STAT:
+		default:
+			return fmt.Errorf("%s isn't a stat", Kind(entries[i].Kind))
+		}
+	}
+	if !Supports(XETH_MSG_KIND_STATS) {
+		return setEachStat(entries)
+	}
+	buf := Pool.Get(SizeofMsgStats + (len(entries) * SizeofMsgStatsEntry))
+	defer Pool.Put(buf)
+	msg := ToMsgStats(buf)
+	msg.Kind = uint8(XETH_MSG_KIND_STATS)
+	msg.N = uint32(len(entries))
+	copy(msg.Entries(), entries)
+	return Tx(buf)
+}
+
+// Queue a stat message per entry for drivers without batches.
+func setEachStat(entries []MsgStatsEntry) error {
+	buf := Pool.Get(SizeofMsgStat)
+	defer Pool.Put(buf)
+	for i := range entries {
+		msg := ToMsgStat(buf)
+		msg.Kind = entries[i].Kind
+		msg.Ifindex = entries[i].Ifindex
+		msg.Index = uint64(entries[i].Index)
+		msg.Count = entries[i].Count
+		if err := Tx(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the entries that follow the message header. The message must have
+// been allocated or validated with SizeofMsgStats + N*SizeofMsgStatsEntry.
+func (msg *MsgStats) Entries() []MsgStatsEntry {
+	var entries []MsgStatsEntry
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&entries))
+	hdr.Data = uintptr(unsafe.Pointer(msg)) + SizeofMsgStats
+	hdr.Len = int(msg.N)
+	hdr.Cap = int(msg.N)
+	return entries
+}
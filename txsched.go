@@ -0,0 +1,281 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Tx queues messages by class and gotx sends those of the control class
+// before any of the stats class.
+type TxClass uint8
+
+const (
+	TxControl TxClass = iota
+	TxStats
+	NTxClasses
+)
+
+func (class TxClass) String() string {
+	var classes = []string{
+		"control",
+		"stats",
+	}
+	if i := int(class); i < len(classes) {
+		return classes[i]
+	}
+	return fmt.Sprint("@", int(class))
+}
+
+// Return the class of the given message kind.
+func TxClassOf(kind Kind) TxClass {
+	switch kind {
+	case XETH_MSG_KIND_LINK_STAT,
+		XETH_MSG_KIND_ETHTOOL_STAT,
+		XETH_MSG_KIND_STATS:
+		return TxStats
+	}
+	return TxControl
+}
+
+type TxClassConfig struct {
+	// Messages queued before Tx drops, default 4
+	Depth int
+	// Token bucket of Rate messages per second, unlimited if zero, and
+	// Burst tokens, default 1
+	Rate  float64
+	Burst int
+	// If not nil, called by Tx, outside of its queue lock, with the kind of
+	// each dropped message
+	OnDrop func(Kind)
+}
+
+type TxClassCounters struct {
+	// Messages queued, sent, dropped when full, and failed to send
+	Queued, Sent, Dropped, Errors uint64
+	// Time sends waited for a token
+	Throttled time.Duration
+}
+
+// TxClasses configures the scheduler of each class; Start copies it, so
+// changes, including OnDrop, take effect with the next Start.
+var TxClasses = [NTxClasses]TxClassConfig{
+	TxControl: {Depth: 64},
+	TxStats:   {Depth: 256},
+}
+
+var txcounters [NTxClasses]TxClassCounters
+
+// Return a copy of the counters of the given class.
+func TxCounters(class TxClass) TxClassCounters {
+	p := &txcounters[class]
+	return TxClassCounters{
+		Queued:    atomic.LoadUint64(&p.Queued),
+		Sent:      atomic.LoadUint64(&p.Sent),
+		Dropped:   atomic.LoadUint64(&p.Dropped),
+		Errors:    atomic.LoadUint64(&p.Errors),
+		Throttled: time.Duration(atomic.LoadInt64((*int64)(&p.Throttled))),
+	}
+}
+
+type tokenBucket struct {
+	rate, burst, tokens float64
+	last                time.Time
+}
+
+func (b *tokenBucket) init(config *TxClassConfig) {
+	b.rate = config.Rate
+	b.burst = float64(config.Burst)
+	if b.burst < 1 {
+		b.burst = 1
+	}
+	b.tokens = b.burst
+	b.last = time.Now()
+}
+
+// Return time until a token is available.
+func (b *tokenBucket) delay() time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take() {
+	if b.rate > 0 {
+		b.tokens--
+	}
+}
+
+func newTxQueues() {
+	for class := range xeth.txq {
+		depth := xeth.txconfig[class].Depth
+		if depth <= 0 {
+			depth = 4
+		}
+		xeth.txq[class] = make(chan []byte, depth)
+	}
+}
+
+func closeTxQueues() {
+	for _, q := range xeth.txq {
+		close(q)
+	}
+}
+
+// DropError is returned by Tx when the message's class queue is full.
+type DropError struct {
+	Kind
+	TxClass
+}
+
+func (err *DropError) Error() string {
+	return fmt.Sprint(err.Kind, " dropped by full ", err.TxClass, " queue")
+}
+
+// Queue a copy of the message in its class to send when the class has a
+// token and no higher priority message is waiting; returns a *DropError if
+// its class queue is full. Errors sending queued messages are only counted.
+func Tx(buf []byte) error {
+	kind := KindOf(buf)
+	onDrop, err := txQueue(buf, kind, TxClassOf(kind))
+	if onDrop != nil {
+		onDrop(kind)
+	}
+	return err
+}
+
+// Queue a copy of the message while holding the lock that Stop takes to
+// close the queues; returns the class's OnDrop if dropped.
+func txQueue(buf []byte, kind Kind, class TxClass) (func(Kind), error) {
+	xeth.txmutex.RLock()
+	defer xeth.txmutex.RUnlock()
+	if xeth.sock == nil {
+		return nil, io.EOF
+	}
+	if !Supports(kind) {
+		return nil, &UnsupportedError{kind}
+	}
+	msg := Pool.Get(len(buf))
+	copy(msg, buf)
+	select {
+	case xeth.txq[class] <- msg:
+		atomic.AddUint64(&Count.Tx.Sent, 1)
+		atomic.AddUint64(&txcounters[class].Queued, 1)
+		return nil, nil
+	default:
+		atomic.AddUint64(&Count.Tx.Dropped, 1)
+		atomic.AddUint64(&txcounters[class].Dropped, 1)
+		Pool.Put(msg)
+		return xeth.txconfig[class].OnDrop, &DropError{kind, class}
+	}
+}
+
+func gotx(sock *net.UnixConn, txq [NTxClasses]chan []byte,
+	config [NTxClasses]TxClassConfig) {
+	var buckets [NTxClasses]tokenBucket
+	for class := range buckets {
+		buckets[class].init(&config[class])
+	}
+	send := func(class TxClass, msg []byte) {
+		if wait := buckets[class].delay(); wait > 0 {
+			time.Sleep(wait)
+			atomic.AddInt64((*int64)(&txcounters[class].Throttled),
+				int64(wait))
+			buckets[class].delay()
+		}
+		buckets[class].take()
+		if err := txTo(sock, msg, 10*time.Millisecond); err != nil {
+			atomic.AddUint64(&txcounters[class].Errors, 1)
+		} else {
+			atomic.AddUint64(&txcounters[class].Sent, 1)
+		}
+		Pool.Put(msg)
+	}
+	control, stats := txq[TxControl], txq[TxStats]
+	// a stats message waiting for a token
+	var held []byte
+	for control != nil || stats != nil || held != nil {
+		if held != nil {
+			wait := buckets[TxStats].delay()
+			if wait == 0 {
+				send(TxStats, held)
+				held = nil
+				continue
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case msg, ok := <-control:
+				if ok {
+					send(TxControl, msg)
+				} else {
+					control = nil
+				}
+			case <-timer.C:
+				atomic.AddInt64(
+					(*int64)(&txcounters[TxStats].Throttled),
+					int64(wait))
+			}
+			timer.Stop()
+			continue
+		}
+		select {
+		case msg, ok := <-control:
+			if ok {
+				send(TxControl, msg)
+			} else {
+				control = nil
+			}
+			continue
+		default:
+		}
+		select {
+		case msg, ok := <-control:
+			if ok {
+				send(TxControl, msg)
+			} else {
+				control = nil
+			}
+		case msg, ok := <-stats:
+			if ok {
+				held = msg
+			} else {
+				stats = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	var b tokenBucket
+	b.init(&TxClassConfig{Rate: 100, Burst: 2})
+	for i := 0; i < 2; i++ {
+		if wait := b.delay(); wait != 0 {
+			t.Fatal("burst", i, "waits", wait)
+		}
+		b.take()
+	}
+	wait := b.delay()
+	if wait <= 0 || wait > 10*time.Millisecond {
+		t.Fatal("wait", wait)
+	}
+	time.Sleep(wait)
+	if wait = b.delay(); wait != 0 {
+		t.Fatal("refill waits", wait)
+	}
+	b.init(&TxClassConfig{})
+	for i := 0; i < 10; i++ {
+		if wait = b.delay(); wait != 0 {
+			t.Fatal("unlimited waits", wait)
+		}
+		b.take()
+	}
+}
+
+// Replace the driver socket with one end of a socket pair and return the
+// other, as if to a driver before hello; skips if a driver is running.
+func pairSock(t *testing.T) *net.UnixConn {
+	if xeth.sock != nil {
+		t.Skip("driver running")
+	}
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET,
+		0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conns [2]*net.UnixConn
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "xeth-test")
+		conn, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[i] = conn.(*net.UnixConn)
+	}
+	saved := xeth.driver
+	xeth.sock = conns[0]
+	xeth.driver.negotiated = false
+	t.Cleanup(func() {
+		xeth.sock = nil
+		xeth.driver = saved
+		conns[0].Close()
+		conns[1].Close()
+	})
+	return conns[1]
+}
+
+func TestGotxPriority(t *testing.T) {
+	peer := pairSock(t)
+	var txq [NTxClasses]chan []byte
+	for class := range txq {
+		txq[class] = make(chan []byte, 4)
+	}
+	queue := func(kind Kind, ifindex int32) {
+		buf := Pool.Get(SizeofMsgStat)
+		msg := ToMsgStat(buf)
+		msg.Kind = uint8(kind)
+		msg.Ifindex = ifindex
+		txq[TxClassOf(kind)] <- buf
+	}
+	queue(XETH_MSG_KIND_LINK_STAT, 1)
+	queue(XETH_MSG_KIND_STATS, 2)
+	queue(XETH_MSG_KIND_CARRIER, 3)
+	queue(XETH_MSG_KIND_ETHTOOL_STAT, 4)
+	queue(XETH_MSG_KIND_SPEED, 5)
+	for _, q := range txq {
+		close(q)
+	}
+	before := TxCounters(TxControl)
+	gotx(xeth.sock, txq, TxClasses)
+	if sent := TxCounters(TxControl).Sent - before.Sent; sent != 2 {
+		t.Error("sent", sent, "control messages")
+	}
+	buf := make([]byte, PageSize)
+	for _, want := range []int32{3, 5, 1, 2, 4} {
+		n, err := peer.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ToMsgStat(buf[:n]).Ifindex; got != want {
+			t.Fatal("sent", got, "before", want)
+		}
+	}
+}
+
+func TestTxDrop(t *testing.T) {
+	pairSock(t)
+	saved, config, txconfig := xeth.txq, TxClasses, xeth.txconfig
+	defer func() {
+		xeth.txq, TxClasses, xeth.txconfig = saved, config, txconfig
+	}()
+	var dropped []Kind
+	xeth.txconfig[TxStats].OnDrop = func(kind Kind) {
+		dropped = append(dropped, kind)
+	}
+	// Tx uses the config copied by Start
+	TxClasses[TxStats].OnDrop = func(kind Kind) {
+		t.Error("OnDrop changed after Start")
+	}
+	xeth.txq[TxControl] = make(chan []byte, 1)
+	xeth.txq[TxStats] = make(chan []byte, 1)
+	before := TxCounters(TxStats)
+	buf := make([]byte, SizeofMsgStat)
+	ToMsg(buf).Kind = XETH_MSG_KIND_LINK_STAT
+	if err := Tx(buf); err != nil {
+		t.Fatal(err)
+	}
+	ToMsg(buf).Kind = XETH_MSG_KIND_ETHTOOL_STAT
+	var drop *DropError
+	if err := Tx(buf); !errors.As(err, &drop) ||
+		drop.Kind != XETH_MSG_KIND_ETHTOOL_STAT ||
+		drop.TxClass != TxStats {
+		t.Error("expected drop, got", err)
+	}
+	if len(dropped) != 1 || dropped[0] != XETH_MSG_KIND_ETHTOOL_STAT {
+		t.Error("OnDrop", dropped)
+	}
+	after := TxCounters(TxStats)
+	if after.Queued-before.Queued != 1 ||
+		after.Dropped-before.Dropped != 1 {
+		t.Errorf("%+v", after)
+	}
+	// the control queue is separate
+	ToMsg(buf).Kind = XETH_MSG_KIND_CARRIER
+	if err := Tx(buf); err != nil {
+		t.Error(err)
+	}
+	for _, q := range xeth.txq {
+		Pool.Put(<-q)
+	}
+}
+
+// Stop mustn't close the queues under a concurrent Tx.
+func TestTxStop(t *testing.T) {
+	pairSock(t)
+	saved := xeth.txq
+	defer func() { xeth.txq = saved }()
+	newTxQueues()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, SizeofMsgCarrier)
+			ToMsg(buf).Kind = XETH_MSG_KIND_CARRIER
+			for Tx(buf) != io.EOF {
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond)
+	Stop()
+	wg.Wait()
+	for _, q := range xeth.txq {
+		for msg := range q {
+			Pool.Put(msg)
+		}
+	}
+}
@@ -1,4 +1,4 @@
 package xeth
 
 // Version format :: v<MAJOR>.<MINOR>.<PATCH>[-rc<CANDIDATE>]
-const Version = "v1.1.1"
+const Version = "v1.2.0"
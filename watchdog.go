@@ -0,0 +1,260 @@
+/* Copyright(c) 2018 Platina Systems, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify it
+ * under the terms and conditions of the GNU General Public License,
+ * version 2, as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+ * more details.
+ *
+ * You should have received a copy of the GNU General Public License along with
+ * this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin St - Fifth Floor, Boston, MA 02110-1301 USA.
+ *
+ * The full GNU General Public License is included in this distribution in
+ * the file called "COPYING".
+ *
+ * Contact Information:
+ * sw@platina.com
+ * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
+ */
+
+package xeth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Health uint8
+
+const (
+	HealthOK Health = iota
+	// No message received within Watchdog.Silence
+	HealthSilent
+	// No reply to a probe within Watchdog.ProbeTimeout
+	HealthStuck
+	// Disconnected or probe tx failed
+	HealthDown
+)
+
+func (health Health) String() string {
+	var healths = []string{
+		"ok",
+		"silent",
+		"stuck",
+		"down",
+	}
+	if i := int(health); i < len(healths) {
+		return healths[i]
+	}
+	return fmt.Sprint("@", int(health))
+}
+
+// unix nanoseconds of the last received message
+var rxtime int64
+
+// Called by gorx with each validated message.
+func received() {
+	atomic.StoreInt64(&rxtime, time.Now().UnixNano())
+}
+
+// Return the time of the last message received from the driver.
+func LastRx() time.Time {
+	if ns := atomic.LoadInt64(&rxtime); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// Watchdog checks the liveness of the driver every Interval. With Probe, each
+// check sends a sequenced break request with Do and times its ack; or, if the
+// driver hasn't negotiated acks, sends an ifinfo dump request and times the
+// break that closes the dump. Like any other, that dump refreshes the
+// Interface cache and is forwarded to RxCh, which the application must keep
+// reading for the break to arrive.
+type Watchdog struct {
+	// Time between checks, default 1s
+	Interval time.Duration
+	// If not zero, degrade to HealthSilent after this long without rx
+	Silence time.Duration
+	// Send a probe with each check and wait up to ProbeTimeout, default
+	// 1s, for its reply.
+	Probe        bool
+	ProbeTimeout time.Duration
+	// If not nil, called with each change of Health
+	OnChange func(Health)
+
+	mutex  sync.Mutex
+	health Health
+	stats  WatchdogStats
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+type WatchdogStats struct {
+	Checks uint64
+	// Probes sent, their replies, timeouts, and tx errors
+	Probes, Replies, Timeouts, TxErrors uint64
+	// Time from probe request to its ack, nak, or dump break
+	LastRtt, MinRtt, MaxRtt, TotalRtt time.Duration
+	LastRx                            time.Time
+}
+
+// Return the mean round trip of probe replies.
+func (stats *WatchdogStats) MeanRtt() time.Duration {
+	if stats.Replies == 0 {
+		return 0
+	}
+	return stats.TotalRtt / time.Duration(stats.Replies)
+}
+
+// Check every Interval until Stop.
+func (w *Watchdog) Start() {
+	interval := w.Interval
+	if interval == 0 {
+		interval = time.Second
+	}
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.Check()
+			}
+		}
+	}()
+}
+
+// Stop checking and wait for any check in progress.
+func (w *Watchdog) Stop() {
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.stop = nil
+}
+
+// Return the Health as of the last check.
+func (w *Watchdog) Health() Health {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.health
+}
+
+// Return a copy of the check and probe stats.
+func (w *Watchdog) Stats() WatchdogStats {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.stats
+}
+
+// Check the driver's liveness, with a probe if enabled, then return its
+// Health after calling OnChange if it has changed.
+func (w *Watchdog) Check() Health {
+	health := HealthOK
+	if xeth.sock == nil {
+		health = HealthDown
+	} else if w.Probe {
+		health = w.probe()
+	}
+	lastrx := LastRx()
+	if health == HealthOK && w.Silence != 0 &&
+		time.Since(lastrx) > w.Silence {
+		health = HealthSilent
+	}
+	w.mutex.Lock()
+	w.stats.Checks++
+	w.stats.LastRx = lastrx
+	changed := health != w.health
+	w.health = health
+	w.mutex.Unlock()
+	if changed && w.OnChange != nil {
+		w.OnChange(health)
+	}
+	return health
+}
+
+func (w *Watchdog) probe() Health {
+	timeout := w.ProbeTimeout
+	if timeout == 0 {
+		timeout = time.Second
+	}
+	sent := time.Now()
+	var err error
+	if Supports(XETH_MSG_KIND_ACK) {
+		err = probeAck(timeout)
+	} else {
+		err = probeDump(timeout)
+	}
+	rtt := time.Since(sent)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.stats.Probes++
+	switch {
+	case err == nil:
+		w.stats.Replies++
+		w.stats.LastRtt = rtt
+		w.stats.TotalRtt += rtt
+		if w.stats.MinRtt == 0 || rtt < w.stats.MinRtt {
+			w.stats.MinRtt = rtt
+		}
+		if rtt > w.stats.MaxRtt {
+			w.stats.MaxRtt = rtt
+		}
+		return HealthOK
+	case errors.Is(err, context.DeadlineExceeded):
+		w.stats.Timeouts++
+		return HealthStuck
+	default:
+		w.stats.TxErrors++
+		return HealthDown
+	}
+}
+
+func probeAck(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	buf := Pool.Get(SizeofMsgBreak)
+	defer Pool.Put(buf)
+	err := Do(ctx, buf)
+	var nak *NakError
+	if errors.As(err, &nak) {
+		// the driver is alive even if it doesn't accept a break
+		err = nil
+	}
+	return err
+}
+
+// Request an ifinfo dump then wait for the break that closes it.
+func probeDump(timeout time.Duration) error {
+	// discard the break of an earlier dump
+	select {
+	case <-xeth.rxbreak:
+	default:
+	}
+	if err := DumpIfinfo(); err != nil {
+		return err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-xeth.rxbreak:
+		return nil
+	case <-timer.C:
+		return context.DeadlineExceeded
+	}
+}
@@ -25,10 +25,13 @@
 package xeth
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -36,35 +39,70 @@ import (
 const netname = "unixpacket"
 
 var (
+	// Library counters; read with atomic.LoadUint64
 	Count struct {
 		Tx struct {
 			Sent, Dropped uint64
 		}
+		Rx struct {
+			// Valid and invalid messages
+			Received, Invalid uint64
+			// by message kind
+			Kinds [XETH_MSG_KIND_NOT_MSG]uint64
+		}
 	}
 	// Receive message channel feed from sock by gorx
 	RxCh <-chan []byte
+	// Abstract socket address of the driver, or of a sim.Simulator
+	DriverAddr = "@xeth"
 
 	xeth struct {
 		name string
 		addr *net.UnixAddr
 		sock *net.UnixConn
 
-		rxch chan []byte
-		txch chan []byte
+		platform *Platform
+		driver   struct {
+			version    string
+			negotiated bool
+			supports   [XETH_HELLO_NKINDS]bool
+		}
+
+		rxch  chan []byte
+		hello chan []byte
+		// signaled by gorx with each dumped ifinfo and break for RxCh
+		// and closed on its exit
+		dumping chan struct{}
+		// signaled by gorx with each break for RxCh
+		rxbreak chan struct{}
+		// held by Tx to keep Stop from closing txq under its send
+		txmutex  sync.RWMutex
+		txq      [NTxClasses]chan []byte
+		txconfig [NTxClasses]TxClassConfig
 	}
 )
 
 // Connect to @xeth socket and run channel service routines
 // driver :: XETH driver name (e.g. "platina-mk1")
+//
+// Start installs the ethtool names of the driver's registered Platform or
+// falls back to Generic; then with EthtoolDiscovery, replaces these with the
+// names reported by the driver.
 func Start(driver string) error {
 	var err error
 	xeth.name = driver
-	xeth.addr, err = net.ResolveUnixAddr(netname, "@xeth")
+	if platform, found := PlatformOf(driver); found {
+		platform.install()
+	} else {
+		Generic.install()
+	}
+	xeth.addr, err = net.ResolveUnixAddr(netname, DriverAddr)
 	if err != nil {
 		return err
 	}
+	var sock *net.UnixConn
 	for {
-		xeth.sock, err = net.DialUnix(netname, nil, xeth.addr)
+		sock, err = net.DialUnix(netname, nil, xeth.addr)
 		if err == nil {
 			break
 		}
@@ -73,19 +111,40 @@ func Start(driver string) error {
 		}
 	}
 	xeth.rxch = make(chan []byte, 4)
-	xeth.txch = make(chan []byte, 4)
+	xeth.hello = make(chan []byte, 1)
+	xeth.dumping = make(chan struct{}, 1)
+	xeth.rxbreak = make(chan struct{}, 1)
+	xeth.txmutex.Lock()
+	xeth.sock = sock
+	xeth.txconfig = TxClasses
+	newTxQueues()
+	xeth.txmutex.Unlock()
 	Interface.index = make(map[int32]*InterfaceEntry)
 	Interface.dir = make(map[string]*InterfaceEntry)
+	Interface.netns = make(map[Netns]map[string]*InterfaceEntry)
 	RxCh = xeth.rxch
 	go gorx()
-	go gotx()
+	go gotx(sock, xeth.txq, xeth.txconfig)
+
+	if err = hello(); err != nil {
+		Stop()
+		return err
+	}
 
-	// load Interface cache
-	DumpIfinfo()
+	// load Interface cache with the dump requested by hello
 	UntilBreak(func(buf []byte) error {
 		return nil
 	})
 
+	if EthtoolDiscovery {
+		mismatches, err := DiscoverEthtoolNames()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "xeth ethtool discovery", err)
+		}
+		for _, m := range mismatches {
+			fmt.Fprintln(os.Stderr, "xeth ethtool discovery", m)
+		}
+	}
 	return nil
 }
 
@@ -96,31 +155,26 @@ func Stop() {
 		SHUT_WR
 		SHUT_RDWR
 	)
-	if xeth.sock == nil {
+	xeth.txmutex.Lock()
+	sock := xeth.sock
+	if sock == nil {
+		xeth.txmutex.Unlock()
 		return
 	}
-	close(xeth.txch)
-	sock := xeth.sock
 	xeth.sock = nil
+	closeTxQueues()
+	xeth.txmutex.Unlock()
 	if f, err := sock.File(); err == nil {
 		syscall.Shutdown(int(f.Fd()), SHUT_RDWR)
 	}
 	sock.Close()
-	Interface.indexes = Interface.indexes[:0]
-	for ifindex := range Interface.index {
-		delete(Interface.index, ifindex)
-	}
-	Interface.index = nil
-	for name := range Interface.dir {
-		delete(Interface.dir, name)
-	}
-	Interface.dir = nil
+	Interface.reset()
 }
 
 // Return driver name (e.g. "platina-mk1")
 func String() string { return xeth.name }
 
-// Send carrier state change message
+// Queue carrier state change message
 func Carrier(ifindex int32, flag uint8) error {
 	buf := Pool.Get(SizeofMsgCarrier)
 	defer Pool.Put(buf)
@@ -128,7 +182,7 @@ func Carrier(ifindex int32, flag uint8) error {
 	msg.Kind = uint8(XETH_MSG_KIND_CARRIER)
 	msg.Ifindex = ifindex
 	msg.Flag = flag
-	return tx(buf, 0)
+	return Tx(buf)
 }
 
 // Send DumpFib request
@@ -156,30 +210,78 @@ func DumpIfinfo() error {
 	return tx(buf, 0)
 }
 
-// Send stat update message
+// Send ethtool private flags change message then cache the flags once acked;
+// or, with a driver that doesn't ack, once it echoes them.
+func SetEthtoolFlags(ifindex int32, flags EthtoolPrivFlags) error {
+	if Interface.cached(ifindex) == nil {
+		return fmt.Errorf("ifindex %d unknown", ifindex)
+	}
+	buf := Pool.Get(SizeofMsgEthtoolFlags)
+	defer Pool.Put(buf)
+	msg := ToMsgEthtoolFlags(buf)
+	msg.Kind = uint8(XETH_MSG_KIND_ETHTOOL_FLAGS)
+	msg.Ifindex = ifindex
+	msg.Flags = uint32(flags)
+	if acked, err := request(buf); !acked {
+		return err
+	}
+	return Interface.set(ifindex, msg)
+}
+
+// Send ethtool link settings change message with the link mode masks sized
+// as the driver reported for this interface and without the read-only
+// partner modes. The settings are cached once acked; or, with a driver that
+// doesn't ack, once it echoes them.
+func SetEthtoolSettings(ifindex int32, settings *EthtoolSettings) error {
+	nwords, found := Interface.nwords(ifindex)
+	if !found {
+		return fmt.Errorf("ifindex %d unknown", ifindex)
+	}
+	buf := Pool.Get(SizeofMsgEthtoolSettingsNwords(nwords))
+	defer Pool.Put(buf)
+	msg := ToMsgEthtoolSettings(buf)
+	msg.Kind = uint8(XETH_MSG_KIND_ETHTOOL_SETTINGS)
+	msg.Ifindex = ifindex
+	msg.Speed = uint32(settings.Speed)
+	msg.Duplex = uint8(settings.Duplex)
+	msg.Port = uint8(settings.DevPort)
+	msg.Autoneg = uint8(settings.Autoneg)
+	msg.Link_mode_masks_nwords = int8(nwords)
+	// leave the partner modes zero
+	supported, advertising, _ := msg.LinkModeMasks()
+	var sent struct {
+		Supported
+		Advertising
+	}
+	copy(supported, settings.Supported[:])
+	copy(advertising, settings.Advertising[:])
+	copy(sent.Supported[:], supported)
+	copy(sent.Advertising[:], advertising)
+	if acked, err := request(buf); !acked {
+		return err
+	}
+	return Interface.set(ifindex, settings.Speed, settings.Autoneg,
+		settings.Duplex, settings.DevPort, &sent.Supported,
+		&sent.Advertising)
+}
+
+// Queue stat update message
 func SetStat(ifindex int32, stat string, count uint64) error {
-	var statindex uint64
-	var kind uint8
-	if linkstat, found := LinkStatOf(stat); found {
-		kind = uint8(XETH_MSG_KIND_LINK_STAT)
-		statindex = uint64(linkstat)
-	} else if ethtoolstat, found := EthtoolStatOf(stat); found {
-		kind = uint8(XETH_MSG_KIND_ETHTOOL_STAT)
-		statindex = uint64(ethtoolstat)
-	} else {
+	kind, statindex, found := StatIndexOf(stat)
+	if !found {
 		return fmt.Errorf("%q unknown", stat)
 	}
 	buf := Pool.Get(SizeofMsgStat)
 	defer Pool.Put(buf)
 	msg := ToMsgStat(buf)
-	msg.Kind = kind
+	msg.Kind = uint8(kind)
 	msg.Ifindex = ifindex
 	msg.Index = statindex
 	msg.Count = count
-	return tx(buf, 10*time.Millisecond)
+	return Tx(buf)
 }
 
-// Send speed change message
+// Queue speed change message
 func Speed(index int, count uint64) error {
 	buf := Pool.Get(SizeofMsgSpeed)
 	defer Pool.Put(buf)
@@ -187,20 +289,7 @@ func Speed(index int, count uint64) error {
 	msg.Kind = uint8(XETH_MSG_KIND_SPEED)
 	msg.Ifindex = int32(index)
 	msg.Mbps = uint32(count)
-	return tx(buf, 0)
-}
-
-// Send through leaky bucket
-func Tx(buf []byte) {
-	msg := Pool.Get(len(buf))
-	copy(msg, buf)
-	select {
-	case xeth.txch <- msg:
-		Count.Tx.Sent++
-	default:
-		Count.Tx.Dropped++
-		Pool.Put(msg)
-	}
+	return Tx(buf)
 }
 
 func UntilBreak(f func([]byte) error) error {
@@ -236,6 +325,13 @@ func UntilSig(sig <-chan os.Signal, f func([]byte) error) error {
 	}
 }
 
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
 func isEAGAIN(err error) bool {
 	if err != nil {
 		if operr, ok := err.(*net.OpError); ok {
@@ -267,18 +363,25 @@ func gorx() {
 	rxoob := Pool.Get(PageSize)
 	defer Pool.Put(rxoob)
 	defer close(xeth.rxch)
-	for xeth.sock != nil {
-		err := xeth.sock.SetReadDeadline(time.Now().Add(rxto))
+	defer close(xeth.dumping)
+	defer unacked(io.EOF)
+	dumping, rxbreak := xeth.dumping, xeth.rxbreak
+	// Stop clears xeth.sock then closes this to break the loop
+	sock := xeth.sock
+	for {
+		err := sock.SetReadDeadline(time.Now().Add(rxto))
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "xeth set rx deadline", err)
+			if !errors.Is(err, net.ErrClosed) {
+				fmt.Fprintln(os.Stderr, "xeth set rx deadline", err)
+			}
 			break
 		}
 		n, noob, flags, addr, err :=
-			xeth.sock.ReadMsgUnix(rxbuf, rxoob)
+			sock.ReadMsgUnix(rxbuf, rxoob)
 		_ = noob
 		_ = flags
 		_ = addr
-		if n == 0 || isTimeout(err) {
+		if isTimeout(err) || (n == 0 && err == nil) {
 			if rxto < maxrxto {
 				rxto *= 2
 			}
@@ -286,16 +389,41 @@ func gorx() {
 			rxto = minrxto
 			kind := KindOf(rxbuf[:n])
 			if err = kind.validate(rxbuf[:n]); err != nil {
+				atomic.AddUint64(&Count.Rx.Invalid, 1)
 				fmt.Fprintln(os.Stderr, "xeth rx", err)
-				break
+				continue
+			}
+			atomic.AddUint64(&Count.Rx.Received, 1)
+			atomic.AddUint64(&Count.Rx.Kinds[kind], 1)
+			received()
+			if kind == XETH_MSG_KIND_ACK ||
+				kind == XETH_MSG_KIND_NAK {
+				acked(rxbuf[:n])
+				continue
+			}
+			if kind == XETH_MSG_KIND_HELLO {
+				helloed(rxbuf[:n])
+				continue
 			}
 			kind.cache(rxbuf[:n])
+			switch {
+			case kind == XETH_MSG_KIND_BREAK:
+				signal(rxbreak)
+				signal(dumping)
+			case kind == XETH_MSG_KIND_IFINFO &&
+				ToMsgIfinfo(rxbuf[:n]).Reason ==
+					XETH_IFINFO_REASON_DUMP:
+				signal(dumping)
+			}
 			msg := Pool.Get(n)
 			copy(msg, rxbuf[:n])
 			xeth.rxch <- msg
 		} else {
+			// the driver closed the socket, or Stop did
 			e, ok := err.(*os.SyscallError)
-			if !ok || e.Err.Error() != "EOF" {
+			if (!ok || e.Err.Error() != "EOF") &&
+				!errors.Is(err, io.EOF) &&
+				!errors.Is(err, net.ErrClosed) {
 				fmt.Fprintln(os.Stderr, "xeth rx", err)
 			}
 			break
@@ -303,26 +431,29 @@ func gorx() {
 	}
 }
 
-func gotx() {
-	for msg := range xeth.txch {
-		tx(msg, 10*time.Millisecond)
-		Pool.Put(msg)
-	}
+func tx(buf []byte, timeout time.Duration) error {
+	xeth.txmutex.RLock()
+	sock := xeth.sock
+	xeth.txmutex.RUnlock()
+	return txTo(sock, buf, timeout)
 }
 
-func tx(buf []byte, timeout time.Duration) error {
+func txTo(sock *net.UnixConn, buf []byte, timeout time.Duration) error {
 	var oob []byte
 	var dl time.Time
-	if xeth.sock == nil {
+	if sock == nil {
 		return io.EOF
 	}
+	if kind := KindOf(buf); !Supports(kind) {
+		return &UnsupportedError{kind}
+	}
 	if timeout != time.Duration(0) {
 		dl = time.Now().Add(timeout)
 	}
-	err := xeth.sock.SetWriteDeadline(dl)
+	err := sock.SetWriteDeadline(dl)
 	if err != nil {
 		return err
 	}
-	_, _, err = xeth.sock.WriteMsgUnix(buf, oob, nil)
+	_, _, err = sock.WriteMsgUnix(buf, oob, nil)
 	return err
 }
@@ -20,41 +20,469 @@
  * sw@platina.com
  * Platina Systems, 3180 Del La Cruz Blvd, Santa Clara, CA 95054
  */
-package xeth
+package xeth_test
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"syscall"
 	"testing"
+	"time"
 
-	"github.com/platinasystems/xeth/platina/mk1"
+	"github.com/platinasystems/xeth"
+	_ "github.com/platinasystems/xeth/platina/mk1"
+	"github.com/platinasystems/xeth/sim"
 )
 
-var machine = flag.String("test.machine", "platina-mk1",
-	"reference platform's ethtool flag and stat names")
+var (
+	machine = flag.String("test.machine", "platina-mk1",
+		"reference platform's ethtool flag and stat names")
+	simulate = flag.Bool("test.sim", false,
+		"test with a simulated driver")
+	simulator = &sim.Simulator{
+		Interfaces: []sim.Interface{
+			{
+				Name:    "eth-1-1",
+				Ifindex: 3,
+				Flags:   xeth.IFF_UP | xeth.IFF_RUNNING,
+			},
+			{
+				Name:    "eth-2-1",
+				Ifindex: 4,
+				Port:    1,
+				Flags:   xeth.IFF_UP,
+				Settings: &xeth.EthtoolSettings{
+					Speed:   100000,
+					Partner: xeth.Partner{1, 0, 0, 1},
+				},
+				Nwords: xeth.ETHTOOL_LINK_MODE_NWORDS,
+			},
+		},
+		Nak: func(buf []byte) syscall.Errno {
+			switch xeth.KindOf(buf) {
+			case xeth.XETH_MSG_KIND_SPEED:
+				if xeth.ToMsgSpeed(buf).Mbps < 100000 {
+					return syscall.EINVAL
+				}
+			case xeth.XETH_MSG_KIND_ETHTOOL_SETTINGS:
+				if xeth.ToMsgEthtoolSettings(buf).Speed == 1 {
+					return syscall.EINVAL
+				}
+			case xeth.XETH_MSG_KIND_ETHTOOL_FLAGS:
+				if xeth.ToMsgEthtoolFlags(buf).Flags == ^uint32(0) {
+					return syscall.EINVAL
+				}
+			}
+			return 0
+		},
+	}
+	nodriver error
+)
+
+// Skip tests that need a driver if xeth.Start failed.
+func needDriver(t *testing.T) {
+	if nodriver != nil {
+		t.Skip(nodriver)
+	}
+}
 
 func TestMain(m *testing.M) {
 	flag.Parse()
-	switch *machine {
-	case "platina-mk1":
-		EthtoolPrivFlagNames = mk1.EthtoolFlags
-		EthtoolStatNames = mk1.EthtoolStats
-	default:
+	if _, found := xeth.PlatformOf(*machine); !found {
 		fmt.Fprintf(os.Stderr, "machine %q unknown\n", *machine)
 		os.Exit(1)
 	}
-	if err := Start("xeth-test"); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	if *simulate {
+		if err := simulator.Start(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 	}
-	defer Stop()
+	// without a driver, only run the tests that don't need one
+	if nodriver = xeth.Start(*machine); nodriver != nil {
+		fmt.Fprintln(os.Stderr, nodriver)
+	}
+	defer xeth.Stop()
 	os.Exit(m.Run())
 }
 
 func TestShowInterfaces(t *testing.T) {
-	Interface.Iterate(func(entry *InterfaceEntry) error {
+	xeth.Interface.Iterate(func(entry *xeth.InterfaceEntry) error {
 		fmt.Println(entry)
 		return nil
 	})
 }
+
+func TestWatchdog(t *testing.T) {
+	needDriver(t)
+	if !xeth.Supports(xeth.XETH_MSG_KIND_ACK) {
+		t.Skip("driver doesn't ack")
+	}
+	var changes []xeth.Health
+	w := &xeth.Watchdog{
+		Probe:    true,
+		OnChange: func(h xeth.Health) { changes = append(changes, h) },
+	}
+	if h := w.Check(); h != xeth.HealthOK {
+		t.Fatal(h)
+	}
+	stats := w.Stats()
+	if stats.Probes != 1 || stats.Replies != 1 || stats.MaxRtt == 0 ||
+		stats.LastRx.IsZero() {
+		t.Errorf("%+v", stats)
+	}
+	w.ProbeTimeout = time.Nanosecond
+	if h := w.Check(); h != xeth.HealthStuck {
+		t.Error(h)
+	}
+	if stats = w.Stats(); stats.Probes != 2 || stats.Timeouts != 1 {
+		t.Errorf("%+v", stats)
+	}
+	w.ProbeTimeout = 0
+	w.Check()
+	if len(changes) != 2 || changes[0] != xeth.HealthStuck ||
+		changes[1] != xeth.HealthOK {
+		t.Error("changes", changes)
+	}
+}
+
+func TestDo(t *testing.T) {
+	if !*simulate {
+		t.Skip("needs -test.sim")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	buf := xeth.Pool.Get(xeth.SizeofMsgCarrier)
+	defer xeth.Pool.Put(buf)
+	carrier := xeth.ToMsgCarrier(buf)
+	carrier.Kind = uint8(xeth.XETH_MSG_KIND_CARRIER)
+	carrier.Ifindex = 3
+	carrier.Flag = xeth.XETH_CARRIER_ON
+	if err := xeth.Do(ctx, buf); err != nil {
+		t.Error(err)
+	}
+	buf = xeth.Pool.Get(xeth.SizeofMsgSpeed)
+	defer xeth.Pool.Put(buf)
+	speed := xeth.ToMsgSpeed(buf)
+	speed.Kind = uint8(xeth.XETH_MSG_KIND_SPEED)
+	speed.Ifindex = 3
+	speed.Mbps = 1
+	err := xeth.Do(ctx, buf)
+	var nak *xeth.NakError
+	if !errors.As(err, &nak) || !errors.Is(err, syscall.EINVAL) {
+		t.Error("expected nak, got", err)
+	}
+}
+
+func TestHello(t *testing.T) {
+	needDriver(t)
+	if *simulate {
+		if v := xeth.DriverVersion(); v != xeth.Version {
+			t.Error("driver version", v)
+		}
+	}
+	if len(xeth.DriverVersion()) == 0 &&
+		xeth.Supports(xeth.XETH_MSG_KIND_STATS) {
+		t.Error("legacy driver supports stats")
+	}
+}
+
+// Start against a simulator of each protocol, which must not wait out
+// HelloTimeout for a legacy driver.
+func TestStartLegacy(t *testing.T) {
+	if nodriver == nil {
+		t.Skip("driver running")
+	}
+	saved := xeth.DriverAddr
+	defer func() { xeth.DriverAddr = saved }()
+	for _, legacy := range []bool{false, true} {
+		s := &sim.Simulator{
+			Addr:       "@xeth-start-test",
+			Interfaces: simulator.Interfaces,
+			Legacy:     legacy,
+		}
+		if err := s.Start(); err != nil {
+			t.Fatal(err)
+		}
+		xeth.DriverAddr = s.Addr
+		begin := time.Now()
+		err := xeth.Start(*machine)
+		took := time.Since(begin)
+		if err != nil {
+			s.Stop()
+			t.Fatal(err)
+		}
+		if took >= xeth.HelloTimeout {
+			t.Error("legacy", legacy, "Start took", took)
+		}
+		version, stats := xeth.DriverVersion(), xeth.Supports(
+			xeth.XETH_MSG_KIND_STATS)
+		if legacy && (version != "" || stats) {
+			t.Error("legacy driver", version, "supports stats", stats)
+		}
+		if !legacy && (version != xeth.Version || !stats) {
+			t.Error("driver", version, "supports stats", stats)
+		}
+		if n := s.Received(xeth.XETH_MSG_KIND_HELLO); n != 1 {
+			t.Error("legacy", legacy, "received", n, "hellos")
+		}
+		if n := s.Received(xeth.XETH_MSG_KIND_DUMP_IFINFO); n != 1 {
+			t.Error("legacy", legacy, "received", n, "dumps")
+		}
+		if xeth.Interface.Named("eth-2-1") == nil {
+			t.Error("legacy", legacy, "didn't cache eth-2-1")
+		}
+		xeth.Stop()
+		s.Stop()
+	}
+}
+
+// Probe a legacy driver, that doesn't ack, with the break of an ifinfo dump.
+func TestWatchdogLegacy(t *testing.T) {
+	if nodriver == nil {
+		t.Skip("driver running")
+	}
+	saved := xeth.DriverAddr
+	defer func() { xeth.DriverAddr = saved }()
+	s := &sim.Simulator{
+		Addr:       "@xeth-watchdog-test",
+		Interfaces: simulator.Interfaces,
+		Legacy:     true,
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	xeth.DriverAddr = s.Addr
+	if err := xeth.Start(*machine); err != nil {
+		t.Fatal(err)
+	}
+	defer xeth.Stop()
+	var changes []xeth.Health
+	w := &xeth.Watchdog{
+		Probe:        true,
+		ProbeTimeout: 100 * time.Millisecond,
+		OnChange:     func(h xeth.Health) { changes = append(changes, h) },
+	}
+	// the break doesn't arrive until the dump is read from RxCh
+	if h := w.Check(); h != xeth.HealthStuck {
+		t.Error(h)
+	}
+	go func(rxch <-chan []byte) {
+		for buf := range rxch {
+			xeth.Pool.Put(buf)
+		}
+	}(xeth.RxCh)
+	w.ProbeTimeout = 0
+	if h := w.Check(); h != xeth.HealthOK {
+		t.Error(h)
+	}
+	stats := w.Stats()
+	if stats.Probes != 2 || stats.Timeouts != 1 || stats.Replies != 1 ||
+		stats.MaxRtt == 0 {
+		t.Errorf("%+v", stats)
+	}
+	// the hello's dump and one per probe
+	for i := 0; s.Received(xeth.XETH_MSG_KIND_DUMP_IFINFO) != 3; i++ {
+		if i == 100 {
+			t.Fatal("received", s.Received(
+				xeth.XETH_MSG_KIND_DUMP_IFINFO), "dumps")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := s.Received(xeth.XETH_MSG_KIND_BREAK); n != 0 {
+		t.Error("received", n, "break requests")
+	}
+	if len(changes) != 2 || changes[0] != xeth.HealthStuck ||
+		changes[1] != xeth.HealthOK {
+		t.Error("changes", changes)
+	}
+}
+
+// Wait for the simulator to receive another request of the given kind then
+// return a copy of it.
+func nextReceived(t *testing.T, kind xeth.Kind, n uint64) []byte {
+	for i := 0; simulator.Received(kind) == n; i++ {
+		if i == 100 {
+			t.Fatal("no", kind)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return simulator.Last(kind)
+}
+
+func TestSetSpeed(t *testing.T) {
+	if !*simulate {
+		t.Skip("needs -test.sim")
+	}
+	settings := &xeth.EthtoolSettings{Speed: 100000}
+	modes := (*xeth.EthtoolLinkModeBits)(&settings.Supported)
+	modes.Set(xeth.ETHTOOL_LINK_MODE_40000baseCR4_Full)
+	modes.Set(xeth.ETHTOOL_LINK_MODE_100000baseCR4_Full)
+	if err := xeth.SetEthtoolSettings(4, settings); err != nil {
+		t.Fatal(err)
+	}
+	// the simulator naks speeds below 100G
+	var nak *xeth.NakError
+	if err := xeth.SetSpeed(4, 40000); !errors.As(err, &nak) {
+		t.Error("expected nak, got", err)
+	}
+	if speed := xeth.Interface.Indexed(4).Speed; speed != 100000 {
+		t.Error("cached nak'd speed", speed)
+	}
+	settings.Speed = 40000
+	if err := xeth.SetEthtoolSettings(4, settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := xeth.SetSpeed(4, 100000); err != nil {
+		t.Error(err)
+	}
+	if speed := xeth.Interface.Indexed(4).Speed; speed != 100000 {
+		t.Error("didn't cache acked speed", speed)
+	}
+}
+
+func TestSetEthtoolSettings(t *testing.T) {
+	if !*simulate {
+		t.Skip("needs -test.sim")
+	}
+	const kind = xeth.XETH_MSG_KIND_ETHTOOL_SETTINGS
+	settings := &xeth.EthtoolSettings{
+		Speed:   100000,
+		Autoneg: xeth.AUTONEG_DISABLE,
+		Duplex:  xeth.DUPLEX_FULL,
+		Partner: xeth.Partner{^uint32(0)},
+	}
+	modes := (*xeth.EthtoolLinkModeBits)(&settings.Supported)
+	modes.Set(xeth.ETHTOOL_LINK_MODE_100000baseCR4_Full)
+	modes.Set(xeth.ETHTOOL_LINK_MODE_400000baseCR8_Full)
+	settings.Advertising = xeth.Advertising(settings.Supported)
+	// eth-1-1 hasn't reported settings, eth-2-1 has with larger masks
+	for ifindex, nwords := range map[int32]int{
+		3: xeth.XETH_LINK_MODE_MASKS_NWORDS,
+		4: xeth.ETHTOOL_LINK_MODE_NWORDS,
+	} {
+		partner := xeth.Interface.Indexed(ifindex).Partner
+		n := simulator.Received(kind)
+		if err := xeth.SetEthtoolSettings(ifindex, settings); err != nil {
+			t.Fatal(err)
+		}
+		buf := nextReceived(t, kind, n)
+		if len(buf) != xeth.SizeofMsgEthtoolSettingsNwords(nwords) {
+			t.Fatal(ifindex, "size", len(buf))
+		}
+		msg := xeth.ToMsgEthtoolSettings(buf)
+		if msg.Ifindex != ifindex || msg.Speed != 100000 ||
+			int(msg.Link_mode_masks_nwords) != nwords {
+			t.Errorf("%+v", msg)
+		}
+		supported, advertising, sent := msg.LinkModeMasks()
+		for i := 0; i < nwords; i++ {
+			if supported[i] != settings.Supported[i] ||
+				advertising[i] != settings.Advertising[i] ||
+				sent[i] != 0 {
+				t.Error(ifindex, "mask word", i, supported[i],
+					advertising[i], sent[i])
+			}
+		}
+		var want xeth.Supported
+		copy(want[:], supported)
+		entry := xeth.Interface.Indexed(ifindex)
+		if entry.EthtoolSettings.Speed != 100000 ||
+			entry.EthtoolSettings.Supported != want ||
+			entry.EthtoolSettings.Partner != partner {
+			t.Error(ifindex, "cached", entry.EthtoolSettings)
+		}
+	}
+
+	// a nak'd change isn't cached
+	var nak *xeth.NakError
+	refused := *settings
+	refused.Speed = 1
+	if err := xeth.SetEthtoolSettings(3, &refused); !errors.As(err, &nak) {
+		t.Error("expected nak, got", err)
+	}
+	if speed := xeth.Interface.Indexed(3).Speed; speed != 100000 {
+		t.Error("cached nak'd speed", speed)
+	}
+	if err := xeth.SetEthtoolSettings(99, settings); err == nil {
+		t.Error("set settings of unknown ifindex")
+	}
+}
+
+func TestSetEthtoolFlags(t *testing.T) {
+	if !*simulate {
+		t.Skip("needs -test.sim")
+	}
+	const kind = xeth.XETH_MSG_KIND_ETHTOOL_FLAGS
+	var flags xeth.EthtoolPrivFlags
+	if err := flags.Parse("copper fec91"); err != nil {
+		t.Fatal(err)
+	}
+	n := simulator.Received(kind)
+	if err := xeth.SetEthtoolFlags(4, flags); err != nil {
+		t.Fatal(err)
+	}
+	msg := xeth.ToMsgEthtoolFlags(nextReceived(t, kind, n))
+	if msg.Ifindex != 4 || xeth.EthtoolPrivFlags(msg.Flags) != flags {
+		t.Errorf("%+v", msg)
+	}
+	if cached := xeth.Interface.Indexed(4).EthtoolPrivFlags; cached != flags {
+		t.Error("cached", cached)
+	}
+	var nak *xeth.NakError
+	err := xeth.SetEthtoolFlags(4, xeth.EthtoolPrivFlags(^uint32(0)))
+	if !errors.As(err, &nak) {
+		t.Error("expected nak, got", err)
+	}
+	if cached := xeth.Interface.Indexed(4).EthtoolPrivFlags; cached != flags {
+		t.Error("cached nak'd flags", cached)
+	}
+}
+
+func TestSetStats(t *testing.T) {
+	if !*simulate {
+		t.Skip("needs -test.sim")
+	}
+	const kind = xeth.XETH_MSG_KIND_STATS
+	max := xeth.MaxStatsEntries()
+	entries := make([]xeth.MsgStatsEntry, max+3)
+	for i := range entries {
+		entries[i] = xeth.MsgStatsEntry{
+			Ifindex: 3,
+			Index:   uint16(i % 64),
+			Kind:    uint8(xeth.XETH_MSG_KIND_ETHTOOL_STAT),
+			Count:   uint64(i),
+		}
+	}
+	n := simulator.Received(kind)
+	if err := xeth.SetStats(entries); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; simulator.Received(kind) < n+2; i++ {
+		if i == 100 {
+			t.Fatal("received", simulator.Received(kind)-n,
+				"stats messages, expected 2")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	buf := simulator.Last(kind)
+	msg := xeth.ToMsgStats(buf)
+	if msg.N != 3 || len(buf) != xeth.SizeofMsgStats+
+		(3*xeth.SizeofMsgStatsEntry) {
+		t.Fatal("last message has", msg.N, "entries in", len(buf),
+			"bytes")
+	}
+	for i, entry := range msg.Entries() {
+		if entry != entries[max+i] {
+			t.Errorf("entry %d: %+v", i, entry)
+		}
+	}
+	bad := []xeth.MsgStatsEntry{{Kind: uint8(xeth.XETH_MSG_KIND_SPEED)}}
+	if err := xeth.SetStats(bad); err == nil {
+		t.Error("sent", xeth.XETH_MSG_KIND_SPEED, "as a stat")
+	}
+}